@@ -23,10 +23,17 @@ type sysSignal struct {
 	done     chan os.Signal
 	flag     [2]AtomFlag
 	handler  func()
+	sigs     []os.Signal
 }
 
 func NewSysSignal() SysSignal {
+	return NewSysSignalWith(os.Interrupt, os.Kill)
+}
+
+// 指定监视的信号，如syscall.SIGHUP
+func NewSysSignalWith(sig ...os.Signal) SysSignal {
 	s := &sysSignal{
+		sigs: sig,
 		lock: &sync.Mutex{},
 		flag: [2]AtomFlag{
 			NewAtomFlag(),
@@ -41,7 +48,7 @@ func (s *sysSignal) Start(handler func()) {
 		s.handler = handler
 		s.ch = make(chan os.Signal)
 		s.done = make(chan os.Signal)
-		signal.Notify(s.ch, os.Interrupt, os.Kill)
+		signal.Notify(s.ch, s.sigs...)
 		go s.watch()
 		s.wait()
 		s.flag[0].Reset()
@@ -71,6 +78,8 @@ func (s *sysSignal) watch() {
 	s.lock.Unlock()
 
 	sig := <-s.ch
+	//取消注册后关闭，可再次Start
+	signal.Stop(s.ch)
 	close(s.ch)
 	s.done <- sig
 
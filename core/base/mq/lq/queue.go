@@ -10,9 +10,14 @@ import (
 
 // list阻塞队列
 type queue struct {
-	lock *sync.Mutex
-	cond *sync.Cond
-	list *list.List
+	lock     *sync.Mutex
+	cond     *sync.Cond
+	notFull  *sync.Cond
+	list     *list.List
+	n        int
+	limit    int
+	policy   mq.Policy
+	released bool
 }
 
 func NewQueue(size int) mq.BlockQueue {
@@ -23,6 +28,19 @@ func NewQueue(size int) mq.BlockQueue {
 		list: list.New(),
 		lock: &sync.Mutex{}}
 	s.cond = sync.NewCond(s.lock)
+	s.notFull = sync.NewCond(s.lock)
+	return s
+}
+
+// 有界阻塞队列，size<=0不限制
+func NewBoundedQueue(size int, policy mq.Policy) mq.BoundedQueue {
+	s := &queue{
+		list:   list.New(),
+		lock:   &sync.Mutex{},
+		limit:  size,
+		policy: policy}
+	s.cond = sync.NewCond(s.lock)
+	s.notFull = sync.NewCond(s.lock)
 	return s
 }
 
@@ -31,12 +49,96 @@ func (s *queue) Name() string {
 }
 
 func (s *queue) Push(data any) {
+	s.TryPush(data)
+}
+
+// 按队列满处理策略入队，返回是否入队
+func (s *queue) TryPush(data any) (ok bool) {
+	s.lock.Lock()
+	switch mq.IsControl(data) {
+	case true:
+		s.list.PushBack(data)
+		s.cond.Signal()
+		ok = true
+	default:
+		if s.limit > 0 && s.n >= s.limit {
+			switch s.policy {
+			case mq.KBlock:
+				for !s.released && s.limit > 0 && s.n >= s.limit {
+					s.notFull.Wait()
+				}
+				ok = !s.released
+			case mq.KDropOldest:
+				s.dropOldest()
+				ok = true
+			}
+		} else {
+			ok = true
+		}
+		if ok {
+			s.list.PushBack(data)
+			s.n++
+			s.cond.Signal()
+		}
+	}
+	s.lock.Unlock()
+	return
+}
+
+// 不受高水位限制入队(心跳等)，仍计入队列深度
+func (s *queue) PushUnbounded(data any) {
 	s.lock.Lock()
 	s.list.PushBack(data)
+	if !mq.IsControl(data) {
+		s.n++
+	}
 	s.cond.Signal()
 	s.lock.Unlock()
 }
 
+func (s *queue) dropOldest() {
+	for elem := s.list.Front(); elem != nil; elem = elem.Next() {
+		if !mq.IsControl(elem.Value) {
+			s.list.Remove(elem)
+			s.n--
+			return
+		}
+	}
+}
+
+// 出队计数
+func (s *queue) removed(data any) {
+	if !mq.IsControl(data) {
+		s.n--
+		if s.limit > 0 {
+			s.notFull.Broadcast()
+		}
+	}
+}
+
+func (s *queue) Limit() (size int, policy mq.Policy) {
+	s.lock.Lock()
+	size, policy = s.limit, s.policy
+	s.lock.Unlock()
+	return
+}
+
+func (s *queue) SetLimit(size int, policy mq.Policy) {
+	s.lock.Lock()
+	s.limit = size
+	s.policy = policy
+	s.notFull.Broadcast()
+	s.lock.Unlock()
+}
+
+// 消费方退出，唤醒阻塞入队并不再阻塞
+func (s *queue) Release() {
+	s.lock.Lock()
+	s.released = true
+	s.notFull.Broadcast()
+	s.lock.Unlock()
+}
+
 // 一次取一个
 func (s *queue) Pop() (data any, exit, empty bool, code int) {
 	s.lock.Lock()
@@ -52,6 +154,7 @@ func (s *queue) Pop() (data any, exit, empty bool, code int) {
 			code = m.Code
 		}
 		s.list.Remove(elem)
+		s.removed(data)
 		elem = nil
 	}
 	s.lock.Unlock()
@@ -192,6 +295,7 @@ func (s *queue) swap(f func(*list.Element)) {
 		f(elem)
 		next = elem.Next()
 		s.list.Remove(elem)
+		s.removed(elem.Value)
 		elem = nil
 	}
 }
@@ -214,6 +318,7 @@ func (s *queue) swap_until(f func(*list.Element)) (exit bool, code int) {
 		}
 		f(elem)
 		s.list.Remove(elem)
+		s.removed(elem.Value)
 		elem = nil
 	}
 	return
@@ -224,6 +329,7 @@ func (s *queue) clear() {
 	for elem := s.list.Front(); elem != nil; elem = next {
 		next = elem.Next()
 		s.list.Remove(elem)
+		s.removed(elem.Value)
 		elem = nil
 	}
 }
@@ -26,6 +26,35 @@ type BlockQueue interface {
 	Wakeup()
 }
 
+// 队列满处理策略
+type Policy uint8
+
+const (
+	KBlock      Policy = iota //阻塞等待
+	KDropNewest               //丢弃新消息
+	KDropOldest               //丢弃最旧消息
+	KReject                   //拒绝入队，由调用方处理(如关闭慢速对端)
+)
+
+// 有界阻塞队列，nil/ExitStruct/WakeupStruct控制消息不受限制
+type BoundedQueue interface {
+	BlockQueue
+	TryPush(data any) bool
+	PushUnbounded(data any)
+	Limit() (size int, policy Policy)
+	SetLimit(size int, policy Policy)
+	Release()
+}
+
+// 控制消息
+func IsControl(data any) bool {
+	switch data.(type) {
+	case nil, *ExitStruct, *WakeupStruct:
+		return true
+	}
+	return false
+}
+
 var (
 	w = sync.Pool{
 		New: func() any {
@@ -156,6 +156,7 @@ func (s *Read) Put() {
 
 func CreateRead(cmd uint32, msg any, peer conn.Session) *Read {
 	s := readPool.Get().(*Read)
+	s.Handler = nil
 	s.Cmd = cmd
 	s.Msg = msg
 	s.Peer = peer
@@ -185,6 +186,7 @@ func (s *Custom) Put() {
 
 func CreateCustom(cmd uint32, msg any, peer conn.Session) *Custom {
 	s := customPool.Get().(*Custom)
+	s.Handler = nil
 	s.Cmd = cmd
 	s.Msg = msg
 	s.Peer = peer
@@ -108,3 +108,7 @@ func (s *Args) PushBucket(val any, timeout int32) int32 {
 func (s *Args) UpdateBucket(val any, cursor int32, timeout int32) int32 {
 	return s.timerWheel.UpdateBucket(val, cursor, timeout)
 }
+
+func (s *Args) RemoveBucket(val any) {
+	s.timerWheel.RemoveBucket(val)
+}
@@ -3,6 +3,7 @@ package cb
 import (
 	"net"
 	"net/http"
+	"time"
 
 	"github.com/cwloo/gonet/core/net/conn"
 	"github.com/cwloo/gonet/core/net/transmit"
@@ -13,12 +14,18 @@ type OnVerify func(w http.ResponseWriter, r *http.Request) bool
 
 type OnCondition func(peerAddr net.Addr, peerRegion *conn.Region) bool
 
+type OnReject func(peerAddr string, reject conn.Reject)
+
 type OnProtocol func(proto string) transmit.Channel
 
 type OnNewConnection func(conn any, channel transmit.Channel, protoName string, peerRegion *conn.Region, v ...any)
 
 type OnConnectError func(proto string, err error)
 
+type OnRetry func(attempt int, delay time.Duration, err error)
+
+type OnGiveUp func(attempts int, err error)
+
 type OnConnected func(peer conn.Session, v ...any)
 
 type OnClosed func(peer conn.Session, reason conn.Reason, v ...any)
@@ -27,6 +34,8 @@ type OnMessage func(peer conn.Session, msg any, msgType int, recvTime timestamp.
 
 type OnWriteComplete func(peer conn.Session)
 
+type OnGoodbye func(peer conn.Session)
+
 type CloseCallback func(peer conn.Session)
 
 type ErrorCallback func(err error)
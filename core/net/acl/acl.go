@@ -0,0 +1,328 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cwloo/gonet/core/base/cc"
+	"github.com/cwloo/gonet/core/base/mq/lq"
+	"github.com/cwloo/gonet/core/base/watcher"
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	logs "github.com/cwloo/gonet/logs"
+)
+
+var (
+	ErrRule = errors.New("acl invalid rule")
+)
+
+// IP访问控制，支持IPv4/IPv6 CIDR黑白名单
+// 匹配deny拒绝，allow非空时未匹配allow拒绝，其余放行
+//
+// 规则文件每行一条，#开头为注释
+//
+//	allow 10.0.0.0/8
+//	deny 192.168.1.100
+//	deny 2001:db8::/32
+type ACL interface {
+	Allow(cidr ...string) error
+	Deny(cidr ...string) error
+	Reset()
+	Load(file string) error
+	Watch(file string, d time.Duration) error
+	Stop()
+	Check(ip net.IP) bool
+	OnCondition(peerAddr net.Addr, peerRegion *conn.Region) bool
+	Condition(next cb.OnCondition) cb.OnCondition
+}
+
+type acl struct {
+	name    string
+	l       *sync.RWMutex
+	allow   []*net.IPNet
+	deny    []*net.IPNet
+	file    string
+	modTime time.Time
+	watcher watcher.Watcher
+	ticker  *time.Ticker
+	signal  cc.SysSignal
+	sl      *sync.Mutex
+	stopped bool
+	done    chan struct{}
+}
+
+func NewACL(name string) ACL {
+	s := &acl{
+		name: name,
+		l:    &sync.RWMutex{},
+	}
+	return s
+}
+
+// 添加白名单
+func (s *acl) Allow(cidr ...string) error {
+	nets, err := parse(cidr...)
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	s.allow = append(s.allow, nets...)
+	s.l.Unlock()
+	return nil
+}
+
+// 添加黑名单
+func (s *acl) Deny(cidr ...string) error {
+	nets, err := parse(cidr...)
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	s.deny = append(s.deny, nets...)
+	s.l.Unlock()
+	return nil
+}
+
+// 清空规则
+func (s *acl) Reset() {
+	s.l.Lock()
+	s.allow = nil
+	s.deny = nil
+	s.l.Unlock()
+}
+
+// 加载规则文件，替换全部规则，失败时保留原规则
+func (s *acl) Load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	allow, deny := []*net.IPNet{}, []*net.IPNet{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("%v:%v %w", file, line, ErrRule)
+		}
+		nets, err := parse(fields[1])
+		if err != nil {
+			return fmt.Errorf("%v:%v %w", file, line, err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			allow = append(allow, nets...)
+		case "deny":
+			deny = append(deny, nets...)
+		default:
+			return fmt.Errorf("%v:%v %w", file, line, ErrRule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	s.l.Lock()
+	s.allow = allow
+	s.deny = deny
+	s.l.Unlock()
+	logs.Infof("%v %v allow=%v deny=%v", s.name, file, len(allow), len(deny))
+	return nil
+}
+
+// 加载规则文件并热更新
+// d>0 按间隔检查文件修改时间，收到SIGHUP立即重新加载
+func (s *acl) Watch(file string, d time.Duration) error {
+	if s.watcher != nil {
+		return errors.New("acl watching")
+	}
+	if err := s.Load(file); err != nil {
+		return err
+	}
+	s.file = file
+	if fi, err := os.Stat(file); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	s.watcher = watcher.NewWatcher(s.name, lq.NewQueue(0))
+	s.watcher.Start(s.reload)
+	s.done = make(chan struct{})
+	s.sl = &sync.Mutex{}
+	s.stopped = false
+	s.signal = cc.NewSysSignalWith(syscall.SIGHUP)
+	s.signal.Start(s.onSignal)
+	go s.notify()
+	if d > 0 {
+		s.ticker = time.NewTicker(d)
+	}
+	go s.watch()
+	return nil
+}
+
+// SysSignal每次只等待一个信号，处理后重新Start
+func (s *acl) notify() {
+	for {
+		s.signal.WaitSignal()
+		s.signal.Wait()
+		s.sl.Lock()
+		if s.stopped {
+			s.sl.Unlock()
+			return
+		}
+		s.signal.Start(s.onSignal)
+		s.sl.Unlock()
+	}
+}
+
+// 收到SIGHUP重新加载，Stop时不加载
+func (s *acl) onSignal() {
+	s.sl.Lock()
+	if !s.stopped {
+		s.watcher.Push(true)
+	}
+	s.sl.Unlock()
+}
+
+func (s *acl) watch() {
+	var tick <-chan time.Time
+	if s.ticker != nil {
+		tick = s.ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			fi, err := os.Stat(s.file)
+			if err == nil && !fi.ModTime().Equal(s.modTime) {
+				s.modTime = fi.ModTime()
+				s.watcher.Push(true)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *acl) reload(v ...any) (exit bool) {
+	for _, msg := range v {
+		if msg == nil {
+			return true
+		}
+	}
+	if err := s.Load(s.file); err != nil {
+		logs.Errorf("%v %v", s.name, err)
+	}
+	return false
+}
+
+// 停止热更新
+func (s *acl) Stop() {
+	if s.watcher == nil {
+		return
+	}
+	s.sl.Lock()
+	s.stopped = true
+	s.signal.Stop()
+	s.sl.Unlock()
+	if s.ticker != nil {
+		s.ticker.Stop()
+		s.ticker = nil
+	}
+	close(s.done)
+	s.watcher.Stop()
+	s.watcher = nil
+}
+
+// 检查IP是否放行
+func (s *acl) Check(ip net.IP) bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	for _, n := range s.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.allow) == 0 {
+		return true
+	}
+	for _, n := range s.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 可作为cb.OnCondition
+func (s *acl) OnCondition(peerAddr net.Addr, peerRegion *conn.Region) bool {
+	ip := ipOf(peerAddr)
+	if ip == nil {
+		logs.Warnf("%v reject %v invalid address", s.name, peerAddr)
+		return false
+	}
+	if !s.Check(ip) {
+		logs.Warnf("%v reject %v", s.name, peerAddr)
+		return false
+	}
+	return true
+}
+
+// 包装cb.OnCondition，放行后交给next
+func (s *acl) Condition(next cb.OnCondition) cb.OnCondition {
+	return func(peerAddr net.Addr, peerRegion *conn.Region) bool {
+		if !s.OnCondition(peerAddr, peerRegion) {
+			return false
+		}
+		if next != nil {
+			return next(peerAddr, peerRegion)
+		}
+		return true
+	}
+}
+
+func parse(cidr ...string) (nets []*net.IPNet, err error) {
+	for _, c := range cidr {
+		c = strings.TrimSpace(c)
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("%w %v", ErrRule, c)
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, e := net.ParseCIDR(c)
+		if e != nil {
+			return nil, e
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+func ipOf(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,95 @@
+package acl_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/acl"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestCheck(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.txt")
+	err := os.WriteFile(file, []byte("# test\nallow 10.0.0.0/8\nallow 2001:db8::/32\ndeny 10.1.0.0/16\ndeny 2001:db8::1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := acl.NewACL("acl")
+	if err := a.Load(file); err != nil {
+		t.Fatal(err)
+	}
+	for ip, ok := range map[string]bool{
+		"10.2.3.4":    true,
+		"10.1.2.3":    false,
+		"192.168.0.1": false,
+		"2001:db8::2": true,
+		"2001:db8::1": false,
+		"::1":         false,
+	} {
+		if a.Check(net.ParseIP(ip)) != ok {
+			t.Fatalf("%v expect %v", ip, ok)
+		}
+	}
+	os.WriteFile(file, []byte("allow 10.0.0.0/8\nbad\n"), 0644)
+	if err := a.Load(file); err == nil {
+		t.Fatal("expect error")
+	}
+	if a.Check(net.ParseIP("10.1.2.3")) {
+		t.Fatal("rules replaced on error")
+	}
+}
+
+// 等待规则生效
+func eventually(a acl.ACL, ip string, ok bool) bool {
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); {
+		if a.Check(net.ParseIP(ip)) == ok {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+func TestWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.txt")
+	write := func(rules string, modTime time.Time) {
+		if err := os.WriteFile(file, []byte(rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t0 := time.Now().Add(-time.Hour)
+	write("deny 10.0.0.1\n", t0)
+	a := acl.NewACL("acl")
+	if err := a.Watch(file, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+	if a.Check(net.ParseIP("10.0.0.1")) || !a.Check(net.ParseIP("10.0.0.2")) {
+		t.Fatal("initial rules")
+	}
+	//文件修改时间变化后重新加载
+	write("deny 10.0.0.2\n", t0.Add(time.Minute))
+	if !eventually(a, "10.0.0.2", false) || !a.Check(net.ParseIP("10.0.0.1")) {
+		t.Fatal("reload on file change")
+	}
+	//修改时间不变时只由SIGHUP触发重新加载，多次SIGHUP均生效
+	for _, ip := range []string{"10.0.0.3", "10.0.0.4"} {
+		write("deny "+ip+"\n", t0.Add(time.Minute))
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		if !eventually(a, ip, false) {
+			t.Fatalf("reload %v on SIGHUP", ip)
+		}
+	}
+}
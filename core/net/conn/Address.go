@@ -1,16 +1,36 @@
 package conn
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 )
 
+var (
+	ErrScheme = errors.New("unsupported scheme")
+	ErrHost   = errors.New("invalid host")
+	ErrPort   = errors.New("invalid port")
+	ErrPath   = errors.New("unexpected path")
+)
+
+// 缺省端口
+var defaultPorts = map[string]string{
+	"ws":   "80",
+	"wss":  "443",
+	"tls":  "443",
+	"tcps": "443",
+}
+
 // 网络地址结构
 type Address struct {
-	Proto string //ws/wss/tcp
-	Addr  string //ip:port localhost:port
-	Path  string
-	Ip    string
+	Proto string //ws/wss/tcp/tls/tcps/unix/udp/kcp
+	Addr  string //ip:port localhost:port [::1]:port /path/to.sock @abstract
+	Path  string //ws路径，缺省/
+	Query string //ws查询串，不含?
+	Ip    string //解析后的ip，监听全部地址时为空
 	Port  string
 }
 
@@ -18,95 +38,181 @@ func (s *Address) Format() (addr string) {
 	switch s.Proto {
 	case "ws", "wss":
 		addr = fmt.Sprintf("%v://%v%v", s.Proto, s.Addr, s.Path)
-	case "tcp":
+		if s.Query != "" {
+			addr += "?" + s.Query
+		}
+	case "tcp", "tls", "tcps", "udp", "kcp":
+		addr = fmt.Sprintf("%v://%v", s.Proto, s.Addr)
+	case "unix":
 		addr = fmt.Sprintf("%v://%v", s.Proto, s.Addr)
 	}
 	return
 }
 
-func ParseAddress(address string) *Address {
-	//ws://ip:port/path wss://ip:port/path
-	//ws://localhost:port/path wss://localhost:port/path
-	vec := strings.Split(address, "//")
-	switch len(vec) == 2 {
-	case true:
-		proto := strings.ToLower(strings.Trim(vec[0], ":"))
-		switch proto {
-		case "ws", "wss":
-			v := strings.Split(vec[1], "/")
-			switch len(v) {
-			case 1:
-				addr := v[0]
-				path := "/"
-				Ip := ""
-				host := strings.Split(addr, ":")
-				if len(host) == 2 {
-					if host[0] == "localhost" {
-						Ip = "127.0.0.1"
-					} else {
-						Ip = host[0]
-					}
-					port := host[1]
-					return &Address{Proto: proto, Addr: addr, Path: path, Ip: Ip, Port: port}
-				} else {
-					panic("parse " + address + " error")
-				}
-			case 2:
-				addr := v[0]
-				path := v[1]
-				if path == "" {
-					path = "/"
-				} else {
-					path = "/" + path
-				}
-				Ip := ""
-				host := strings.Split(addr, ":")
-				if len(host) == 2 {
-					if host[0] == "localhost" {
-						Ip = "127.0.0.1"
-					} else {
-						Ip = host[0]
-					}
-					port := host[1]
-					return &Address{Proto: proto, Addr: addr, Path: path, Ip: Ip, Port: port}
-				} else {
-					panic("parse " + address + " error")
-				}
-			default:
-				panic("parse " + address + " error")
+// TLS接入的对端地址，OnCondition中断言获取握手状态及客户端证书
+type TLSAddr struct {
+	net.Addr
+	State tls.ConnectionState
+}
+
+// 解析网络地址，未指定协议时为tcp
+//
+//	ws://ip:port/path?query wss://host/a/b ws://[::1]:port/path
+//	tcp://ip:port tls://host:port tcps://[::1]:port udp://ip:port kcp://ip:port
+//	unix:///path/to.sock unix://@abstract
+//	ip:port localhost:port [::1]:port
+func ParseAddress(address string) (*Address, error) {
+	address = strings.TrimSpace(address)
+	proto, rest := "tcp", address
+	if i := strings.Index(address, "://"); i >= 0 {
+		proto, rest = strings.ToLower(address[:i]), address[i+3:]
+	}
+	s := &Address{Proto: proto}
+	switch proto {
+	case "unix":
+		if rest == "" {
+			return nil, fmt.Errorf("parse %q: %w", address, ErrPath)
+		}
+		s.Addr = rest
+		return s, nil
+	case "ws", "wss":
+		if i := strings.IndexByte(rest, '#'); i >= 0 {
+			rest = rest[:i]
+		}
+		if i := strings.IndexAny(rest, "/?"); i >= 0 {
+			s.Path, rest = rest[i:], rest[:i]
+		}
+		if i := strings.IndexByte(s.Path, '?'); i >= 0 {
+			s.Path, s.Query = s.Path[:i], s.Path[i+1:]
+		}
+		if s.Path == "" {
+			s.Path = "/"
+		}
+	case "tcp", "tls", "tcps", "udp", "kcp":
+		rest = strings.TrimSuffix(rest, "/")
+		if strings.ContainsAny(rest, "/?#") {
+			return nil, fmt.Errorf("parse %q: %w", address, ErrPath)
+		}
+	default:
+		return nil, fmt.Errorf("parse %q: %w", address, ErrScheme)
+	}
+	host, port, err := splitHostPort(rest)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", address, err)
+	}
+	if port == "" {
+		port = defaultPorts[proto]
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || (n == 0 && port != "0") {
+		return nil, fmt.Errorf("parse %q: %w", address, ErrPort)
+	}
+	s.Ip, err = resolve(host)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", address, err)
+	}
+	s.Addr = net.JoinHostPort(host, port)
+	s.Port = port
+	return s, nil
+}
+
+// 拆分host/port，port可省略，IPv6须带[]，不带端口时可省略[]
+func splitHostPort(hostport string) (host, port string, err error) {
+	switch {
+	case strings.HasPrefix(hostport, "["):
+		i := strings.IndexByte(hostport, ']')
+		if i < 0 {
+			return "", "", ErrHost
+		}
+		host, port = hostport[1:i], hostport[i+1:]
+		if !isIPv6(host) {
+			return "", "", ErrHost
+		}
+		switch {
+		case port == "":
+		case port[0] == ':':
+			if port = port[1:]; port == "" {
+				return "", "", ErrPort
 			}
 		default:
-			//tcp://ip:port tcp://localhost:port
-			addr := vec[1]
-			host := strings.Split(addr, ":")
-			Ip := ""
-			if len(host) == 2 {
-				if host[0] == "localhost" {
-					Ip = "127.0.0.1"
-				} else {
-					Ip = host[0]
-				}
-				port := host[1]
-				return &Address{Proto: proto, Addr: addr, Ip: Ip, Port: port}
-			}
+			return "", "", ErrPort
+		}
+	case strings.Count(hostport, ":") > 1:
+		//裸IPv6
+		if !isIPv6(hostport) {
+			return "", "", ErrHost
+		}
+		host = hostport
+	case strings.Contains(hostport, ":"):
+		i := strings.IndexByte(hostport, ':')
+		if host, port = hostport[:i], hostport[i+1:]; port == "" {
+			return "", "", ErrPort
 		}
 	default:
-		//ip:port localhost:port
-		proto := "tcp"
-		addr := address
-		host := strings.Split(addr, ":")
-		Ip := ""
-		if len(host) == 2 {
-			if host[0] == "localhost" {
-				Ip = "127.0.0.1"
-			} else {
-				Ip = host[0]
+		if hostport == "" {
+			return "", "", ErrHost
+		}
+		host = hostport
+	}
+	return
+}
+
+func isIPv6(host string) bool {
+	if i := strings.IndexByte(host, '%'); i > 0 {
+		//fe80::1%eth0
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && strings.Contains(host, ":")
+}
+
+// 解析主机名，IPv4优先
+func resolve(host string) (string, error) {
+	switch {
+	case host == "":
+		return "", nil
+	case host == "localhost":
+		return "127.0.0.1", nil
+	case isIPv6(host):
+		return host, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if !isHostname(host) {
+		return "", ErrHost
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	return ips[0].String(), nil
+}
+
+func isHostname(host string) bool {
+	if len(host) > 253 {
+		return false
+	}
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if _, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+		//非法ip
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
 			}
-			port := host[1]
-			return &Address{Proto: proto, Addr: addr, Ip: Ip, Port: port}
-		} else {
-			panic("parse " + address + " error")
 		}
 	}
-	return nil
+	return true
 }
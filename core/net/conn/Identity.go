@@ -0,0 +1,35 @@
+package conn
+
+// 认证身份
+type Identity struct {
+	UserId     string
+	PlatformId int
+	Session    string //登录会话标识
+	Token      string
+	Extra      any
+}
+
+func NewIdentity(userId string, platformId int, session string) *Identity {
+	return &Identity{UserId: userId, PlatformId: platformId, Session: session}
+}
+
+// 认证状态
+type AuthState uint8
+
+const (
+	KAuthNone    AuthState = AuthState(0) //未认证，不限期限
+	KAuthPending AuthState = AuthState(1) //等待认证，超出期限关闭
+	KAuthed      AuthState = AuthState(2) //已认证
+	KAuthFailed  AuthState = AuthState(3) //认证超时已关闭
+)
+
+var (
+	authStates = []string{"none", "pending", "authed", "failed"}
+)
+
+func (s AuthState) String() string {
+	if int(s) < len(authStates) {
+		return authStates[s]
+	}
+	return "unknown"
+}
@@ -0,0 +1,45 @@
+package conn
+
+// 类型化会话上下文键，按指针区分，同名不冲突
+//
+//	var UserKey = conn.NewKey[*User]("user")
+//	UserKey.Set(peer, user)
+//	user, ok := UserKey.Get(peer)
+type Key[T any] struct {
+	name string
+}
+
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (s *Key[T]) String() string {
+	return s.name
+}
+
+// 设置值，返回旧值
+func (s *Key[T]) Set(peer Session, val T) (old T) {
+	if v, ok := peer.SetContextLocker(s, val).(T); ok {
+		old = v
+	}
+	return
+}
+
+func (s *Key[T]) Get(peer Session) (val T, ok bool) {
+	val, ok = peer.GetContextLocker(s).(T)
+	return
+}
+
+// 不存在时返回零值
+func (s *Key[T]) Value(peer Session) (val T) {
+	val, _ = s.Get(peer)
+	return
+}
+
+// 删除并返回旧值
+func (s *Key[T]) Del(peer Session) (old T) {
+	if v, ok := peer.SetContextLocker(s, nil).(T); ok {
+		old = v
+	}
+	return
+}
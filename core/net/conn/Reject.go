@@ -0,0 +1,26 @@
+package conn
+
+type RejectID uint8
+
+const (
+	KNoReject        RejectID = RejectID(0)
+	KRejectMaxConns  RejectID = RejectID(1) //超过最大连接数
+	KRejectMaxPerIP  RejectID = RejectID(2) //超过单IP最大连接数
+	KRejectRate      RejectID = RejectID(3) //超过接受速率
+	KRejectCondition RejectID = RejectID(4) //OnCondition未通过
+)
+
+// 拒绝接入原因
+type Reject struct {
+	Id  RejectID
+	Msg string
+}
+
+var (
+	ENoReject        = Reject{KNoReject, "NoReject"}
+	ERejectMaxConns  = Reject{KRejectMaxConns, "too many connections"}
+	ERejectMaxPerIP  = Reject{KRejectMaxPerIP, "too many connections per ip"}
+	ERejectRate      = Reject{KRejectRate, "accept rate limited"}
+	ERejectCondition = Reject{KRejectCondition, "condition refused"}
+	Rejects          = []Reject{ENoReject, ERejectMaxConns, ERejectMaxPerIP, ERejectRate, ERejectCondition}
+)
@@ -1,6 +1,10 @@
 package conn
 
-import "time"
+import (
+	"time"
+
+	"github.com/cwloo/gonet/utils/codec"
+)
 
 type ReasonID uint8
 
@@ -10,6 +14,8 @@ const (
 	KSelfClosed        ReasonID = ReasonID(2) //本端关闭连接
 	KSelfClosedDelay   ReasonID = ReasonID(3) //本端延时关闭
 	KSelfClosedExpired ReasonID = ReasonID(4) //过期关闭对端
+	KSlowConsumer      ReasonID = ReasonID(5) //发送队列满关闭慢速对端
+	KAuthTimeout       ReasonID = ReasonID(6) //认证超时关闭对端
 )
 
 type Reason struct {
@@ -24,7 +30,17 @@ var (
 	ESelfClosed        = Reason{KSelfClosed, "self closed connection"}
 	ESelfClosedDelay   = Reason{KSelfClosedDelay, "self closed connection delay"}
 	ESelfClosedExpired = Reason{KSelfClosedExpired, "self closed expired connection"}
-	Reasons            = []Reason{ENoError, EPeerClosed, ESelfClosed, ESelfClosedDelay, ESelfClosedExpired}
+	ESlowConsumer      = Reason{KSlowConsumer, "self closed slow consumer"}
+	EAuthTimeout       = Reason{KAuthTimeout, "self closed unauthenticated connection"}
+	Reasons            = []Reason{ENoError, EPeerClosed, ESelfClosed, ESelfClosedDelay, ESelfClosedExpired, ESlowConsumer, EAuthTimeout}
+)
+
+// 合并写完成回调方式
+type CompleteType uint8
+
+const (
+	KCompletePerMsg   CompleteType = CompleteType(0) //每条消息回调一次
+	KCompletePerBatch CompleteType = CompleteType(1) //每批次回调一次
 )
 
 type State uint8
@@ -50,13 +66,26 @@ type Session interface {
 	Connected() bool
 	LocalAddr() string
 	RemoteAddr() string
+	ProxyAddr() string
 	RemoteRegion() Region
+	RTT() time.Duration
+	SetIdleTimeout(d time.Duration)
+	IdleTimeout() time.Duration
+	WSState() *WSState
+	Authenticate(identity *Identity) bool
+	Identity() *Identity
+	AuthState() AuthState
+	SetAuthDeadline(d time.Duration)
 	SetContext(key any, val any) (old any)
 	GetContext(key any) any
 	SetContextLocker(key any, val any) (old any)
 	GetContextLocker(key any) any
+	SetCodec(name string) bool
+	Codec() codec.Codec
 	Write(msg any)
 	WriteText(msg any)
+	WriteWithResult(msg any) bool
+	QueueSize() int
 	Close()
 	CloseAfter(d time.Duration)
 	CloseExpired()
@@ -0,0 +1,9 @@
+package conn
+
+// websocket握手协商结果
+type WSState struct {
+	Subprotocol string //协商的子协议，未协商为空
+	Compression bool   //已协商permessage-deflate
+	ReadLimit   int64  //单条消息最大字节数，0不限制
+	Origin      string //请求Origin，客户端为空
+}
@@ -0,0 +1,101 @@
+package conn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestParseAddress(t *testing.T) {
+	for _, c := range []struct {
+		address string
+		expect  conn.Address
+		err     error
+	}{
+		//tcp
+		{"127.0.0.1:8080", conn.Address{Proto: "tcp", Addr: "127.0.0.1:8080", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"tcp://127.0.0.1:8080", conn.Address{Proto: "tcp", Addr: "127.0.0.1:8080", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"TCP://127.0.0.1:8080/", conn.Address{Proto: "tcp", Addr: "127.0.0.1:8080", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"tcp://localhost:8080", conn.Address{Proto: "tcp", Addr: "localhost:8080", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"tcp://:8080", conn.Address{Proto: "tcp", Addr: ":8080", Port: "8080"}, nil},
+		{"tcp://0.0.0.0:0", conn.Address{Proto: "tcp", Addr: "0.0.0.0:0", Ip: "0.0.0.0", Port: "0"}, nil},
+		{"tcp://[::1]:8080", conn.Address{Proto: "tcp", Addr: "[::1]:8080", Ip: "::1", Port: "8080"}, nil},
+		{"[2001:db8::1]:8080", conn.Address{Proto: "tcp", Addr: "[2001:db8::1]:8080", Ip: "2001:db8::1", Port: "8080"}, nil},
+		{"tcp://[fe80::1%eth0]:8080", conn.Address{Proto: "tcp", Addr: "[fe80::1%eth0]:8080", Ip: "fe80::1%eth0", Port: "8080"}, nil},
+		{"tcp://127.0.0.1", conn.Address{}, conn.ErrPort},
+		{"tcp://127.0.0.1:", conn.Address{}, conn.ErrPort},
+		{"tcp://127.0.0.1:65536", conn.Address{}, conn.ErrPort},
+		{"tcp://127.0.0.1:http", conn.Address{}, conn.ErrPort},
+		{"tcp://::1:8080", conn.Address{}, conn.ErrPort},
+		{"tcp://::g:8080", conn.Address{}, conn.ErrHost},
+		{"tcp://[::1", conn.Address{}, conn.ErrHost},
+		{"tcp://[127.0.0.1]:8080", conn.Address{}, conn.ErrHost},
+		{"tcp://[::1]8080", conn.Address{}, conn.ErrPort},
+		{"tcp://256.0.0.1:8080", conn.Address{}, conn.ErrHost},
+		{"tcp://bad_host!:8080", conn.Address{}, conn.ErrHost},
+		{"tcp://127.0.0.1:8080/path", conn.Address{}, conn.ErrPath},
+		{"", conn.Address{}, conn.ErrHost},
+		//tls/udp/kcp
+		{"tls://127.0.0.1", conn.Address{Proto: "tls", Addr: "127.0.0.1:443", Ip: "127.0.0.1", Port: "443"}, nil},
+		{"tcps://[::1]", conn.Address{Proto: "tcps", Addr: "[::1]:443", Ip: "::1", Port: "443"}, nil},
+		{"udp://127.0.0.1:9000", conn.Address{Proto: "udp", Addr: "127.0.0.1:9000", Ip: "127.0.0.1", Port: "9000"}, nil},
+		{"kcp://[::1]:9000", conn.Address{Proto: "kcp", Addr: "[::1]:9000", Ip: "::1", Port: "9000"}, nil},
+		//ws/wss
+		{"ws://127.0.0.1:8080", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://127.0.0.1:8080/", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://127.0.0.1:8080/ws", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/ws", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://127.0.0.1:8080/a/b/", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/a/b/", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://127.0.0.1:8080/ws?token=x&v=1", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/ws", Query: "token=x&v=1", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://127.0.0.1:8080?token=x#frag", conn.Address{Proto: "ws", Addr: "127.0.0.1:8080", Path: "/", Query: "token=x", Ip: "127.0.0.1", Port: "8080"}, nil},
+		{"ws://localhost/ws", conn.Address{Proto: "ws", Addr: "localhost:80", Path: "/ws", Ip: "127.0.0.1", Port: "80"}, nil},
+		{"wss://[::1]/ws", conn.Address{Proto: "wss", Addr: "[::1]:443", Path: "/ws", Ip: "::1", Port: "443"}, nil},
+		{"wss://[::1]:8443/a/b?x=1", conn.Address{Proto: "wss", Addr: "[::1]:8443", Path: "/a/b", Query: "x=1", Ip: "::1", Port: "8443"}, nil},
+		{"ws://::1/ws", conn.Address{Proto: "ws", Addr: "[::1]:80", Path: "/ws", Ip: "::1", Port: "80"}, nil},
+		{"ws://:8080/ws", conn.Address{Proto: "ws", Addr: ":8080", Path: "/ws", Port: "8080"}, nil},
+		{"ws:///ws", conn.Address{}, conn.ErrHost},
+		{"ws://127.0.0.1:x/ws", conn.Address{}, conn.ErrPort},
+		//unix
+		{"unix:///tmp/test.sock", conn.Address{Proto: "unix", Addr: "/tmp/test.sock"}, nil},
+		{"unix://@abstract", conn.Address{Proto: "unix", Addr: "@abstract"}, nil},
+		{"unix://", conn.Address{}, conn.ErrPath},
+		//scheme
+		{"http://127.0.0.1:8080", conn.Address{}, conn.ErrScheme},
+	} {
+		addr, err := conn.ParseAddress(c.address)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Fatalf("%q expect %v got %v", c.address, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q %v", c.address, err)
+		}
+		if *addr != c.expect {
+			t.Fatalf("%q expect %+v got %+v", c.address, c.expect, *addr)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for address, expect := range map[string]string{
+		"127.0.0.1:8080":           "tcp://127.0.0.1:8080",
+		"wss://[::1]:8443/a/b?x=1": "wss://[::1]:8443/a/b?x=1",
+		"ws://localhost":           "ws://localhost:80/",
+		"unix:///tmp/test.sock":    "unix:///tmp/test.sock",
+		"kcp://127.0.0.1:9000":     "kcp://127.0.0.1:9000",
+	} {
+		addr, err := conn.ParseAddress(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.Format() != expect {
+			t.Fatalf("%q expect %v got %v", address, expect, addr.Format())
+		}
+	}
+}
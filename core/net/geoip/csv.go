@@ -0,0 +1,87 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+// CSV IP段库，每行: 起始IP,结束IP,国家[,地区]，#开头为注释
+//
+//	1.0.1.0,1.0.3.255,中国,福建
+//	2001:db8::,2001:db8::ffff,US,California
+type csvDB struct {
+	ranges []ipRange
+}
+
+type ipRange struct {
+	start  net.IP
+	end    net.IP
+	region conn.Region
+}
+
+func NewCSV(file string) (Resolver, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := &csvDB{}
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("%v:%v %w", file, line, ErrFormat)
+		}
+		start, end := net.ParseIP(strings.TrimSpace(record[0])), net.ParseIP(strings.TrimSpace(record[1]))
+		if start == nil || end == nil || bytes.Compare(start.To16(), end.To16()) > 0 {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("%v:%v %w", file, line, ErrFormat)
+		}
+		region := conn.Region{Country: record[2]}
+		if len(record) > 3 {
+			region.Location = record[3]
+		}
+		s.ranges = append(s.ranges, ipRange{start: start.To16(), end: end.To16(), region: region})
+	}
+	sort.Slice(s.ranges, func(i, j int) bool {
+		return bytes.Compare(s.ranges[i].start, s.ranges[j].start) < 0
+	})
+	return s, nil
+}
+
+func (s *csvDB) Lookup(ip net.IP) (conn.Region, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return conn.Region{}, false
+	}
+	//第一个起始IP大于ip的段
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return bytes.Compare(s.ranges[i].start, ip) > 0
+	})
+	if i > 0 && bytes.Compare(ip, s.ranges[i-1].end) <= 0 {
+		return s.ranges[i-1].region, true
+	}
+	return conn.Region{}, false
+}
+
+func (s *csvDB) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+var (
+	ErrFormat = errors.New("geoip invalid database")
+)
+
+// IP地区解析
+type Resolver interface {
+	Lookup(ip net.IP) (region conn.Region, ok bool)
+	Close() error
+}
+
+// 按扩展名打开离线库并缓存查询，.mmdb为MaxMind格式，其余按CSV解析
+// lang mmdb名称语言，默认zh-CN，缺失时取en
+func Open(file string, lang ...string) (r Resolver, err error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".mmdb":
+		r, err = NewMMDB(file, lang...)
+	default:
+		r, err = NewCSV(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewCache(r, 0), nil
+}
+
+// 查询缓存，并发安全
+// 两代map淘汰，当前代满时整体降为旧代
+type cache struct {
+	r    Resolver
+	size int
+	l    *sync.RWMutex
+	cur  map[string]entry
+	old  map[string]entry
+}
+
+type entry struct {
+	region conn.Region
+	ok     bool
+}
+
+// 包装Resolver缓存查询结果，size每代缓存数
+func NewCache(r Resolver, size int) Resolver {
+	if size <= 0 {
+		size = 10000
+	}
+	return &cache{
+		r:    r,
+		size: size,
+		l:    &sync.RWMutex{},
+		cur:  map[string]entry{},
+		old:  map[string]entry{},
+	}
+}
+
+func (s *cache) Lookup(ip net.IP) (conn.Region, bool) {
+	key := string(ip.To16())
+	s.l.RLock()
+	e, ok := s.cur[key]
+	if !ok {
+		e, ok = s.old[key]
+	}
+	s.l.RUnlock()
+	if !ok {
+		e.region, e.ok = s.r.Lookup(ip)
+	}
+	s.l.Lock()
+	if _, hit := s.cur[key]; !hit {
+		if len(s.cur) >= s.size {
+			s.old = s.cur
+			s.cur = map[string]entry{}
+		}
+		s.cur[key] = e
+	}
+	s.l.Unlock()
+	return e.region, e.ok
+}
+
+func (s *cache) Close() error {
+	return s.r.Close()
+}
+
+// 解析地址中的IP
+func IPOf(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
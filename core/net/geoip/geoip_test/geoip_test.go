@@ -0,0 +1,230 @@
+package geoip_test
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/geoip"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestCSV(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ip.csv")
+	err := os.WriteFile(file, []byte("# start,end,country,location\n"+
+		"1.0.1.0,1.0.3.255,中国,福建\n"+
+		"8.8.8.0,8.8.8.255,US\n"+
+		"2001:db8::,2001:db8::ffff,US,California\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := geoip.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	check(t, r, map[string]conn.Region{
+		"1.0.2.1":      {Country: "中国", Location: "福建"},
+		"8.8.8.8":      {Country: "US"},
+		"2001:db8::10": {Country: "US", Location: "California"},
+		"1.0.4.0":      {},
+		"::1":          {},
+	})
+}
+
+func TestMMDB(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		file := filepath.Join(t.TempDir(), "ip.mmdb")
+		err := os.WriteFile(file, buildMMDB(ipVersion, map[string]map[string]any{
+			"1.0.1.0/24": {
+				"country":      map[string]any{"iso_code": "CN", "names": map[string]any{"en": "China", "zh-CN": "中国"}},
+				"subdivisions": []any{map[string]any{"names": map[string]any{"zh-CN": "福建省"}}},
+				"city":         map[string]any{"names": map[string]any{"zh-CN": "福州"}},
+			},
+			"8.8.0.0/16": {
+				"country": map[string]any{"iso_code": "US"},
+			},
+		}), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := geoip.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, r, map[string]conn.Region{
+			"1.0.1.9": {Country: "中国", Location: "福建省 福州"},
+			"8.8.4.4": {Country: "US"},
+			"1.0.2.1": {},
+		})
+		r.Close()
+	}
+}
+
+// 按MaxMind DB规范生成的GeoIP2-Country结构测试库
+// record_size=28，IPv6树，IPv4位于::/96且::ffff:0:0/96为别名，数据段键名/子结构以指针复用
+func TestMMDBFixture(t *testing.T) {
+	r, err := geoip.Open(filepath.Join("testdata", "country.mmdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	check(t, r, map[string]conn.Region{
+		"81.2.69.160":      {Country: "英国"},
+		"::ffff:81.2.69.1": {Country: "英国"},
+		"89.160.20.120":    {Country: "瑞典"},
+		"216.160.83.60":    {Country: "美国", Location: "华盛顿州 Milton"},
+		"2001:218::1":      {Country: "日本"},
+		"81.2.70.1":        {},
+		"2001:219::1":      {},
+	})
+	r, err = geoip.Open(filepath.Join("testdata", "country.mmdb"), "de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	check(t, r, map[string]conn.Region{
+		"81.2.69.160": {Country: "Vereinigtes Königreich"},
+	})
+}
+
+// 自引用指针不可无限递归
+func TestMMDBCyclic(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ip.mmdb")
+	//指针指向数据段偏移0，即记录自身
+	self := raw{1 << 5, 0}
+	err := os.WriteFile(file, buildMMDB(4, map[string]map[string]any{
+		"1.0.1.0/24": {"country": self, "city": self, "subdivisions": self},
+	}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := geoip.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		check(t, r, map[string]conn.Region{
+			"1.0.1.9": {},
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("cyclic pointer lookup timeout")
+	}
+}
+
+func check(t *testing.T, r geoip.Resolver, cases map[string]conn.Region) {
+	//第二轮命中缓存
+	for i := 0; i < 2; i++ {
+		for ip, expect := range cases {
+			region, ok := r.Lookup(net.ParseIP(ip))
+			if region != expect || ok != (expect != conn.Region{}) {
+				t.Fatalf("%v %+v %v", ip, region, ok)
+			}
+		}
+	}
+}
+
+type node struct {
+	child [2]*node
+	data  []byte
+}
+
+// 生成record_size=24的mmdb
+func buildMMDB(ipVersion int, records map[string]map[string]any) []byte {
+	root := &node{}
+	for cidr, record := range records {
+		ip, n, _ := net.ParseCIDR(cidr)
+		ones, _ := n.Mask.Size()
+		key := []byte(ip.To4())
+		if ipVersion == 6 {
+			//IPv4位于::/96下
+			key, ones = append(make([]byte, 12), key...), ones+96
+		}
+		cur := root
+		for i := 0; i < ones; i++ {
+			bit := key[i>>3] >> (7 - uint(i&7)) & 1
+			if cur.child[bit] == nil {
+				cur.child[bit] = &node{}
+			}
+			cur = cur.child[bit]
+		}
+		cur.data = encode(record)
+	}
+	//内部节点按层编号
+	nodes := []*node{root}
+	for i := 0; i < len(nodes); i++ {
+		for _, c := range nodes[i].child {
+			if c != nil && c.data == nil {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	ids := map[*node]int{}
+	for i, n := range nodes {
+		ids[n] = i
+	}
+	data := []byte{}
+	tree := []byte{}
+	for _, n := range nodes {
+		for _, c := range n.child {
+			v := len(nodes)
+			if c != nil && c.data != nil {
+				v = len(nodes) + 16 + len(data)
+				data = append(data, c.data...)
+			} else if c != nil {
+				v = ids[c]
+			}
+			tree = append(tree, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	b := append(tree, make([]byte, 16)...)
+	b = append(b, data...)
+	b = append(b, "\xAB\xCD\xEFMaxMind.com"...)
+	return append(b, encode(map[string]any{
+		"node_count":  uint32(len(nodes)),
+		"record_size": uint32(24),
+		"ip_version":  uint32(ipVersion),
+	})...)
+}
+
+// 原样写入的编码数据
+type raw []byte
+
+func encode(v any) []byte {
+	b := &bytes.Buffer{}
+	switch v := v.(type) {
+	case raw:
+		b.Write(v)
+	case string:
+		b.WriteByte(2<<5 | byte(len(v)))
+		b.WriteString(v)
+	case uint32:
+		b.WriteByte(6<<5 | 4)
+		b.Write([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+	case map[string]any:
+		b.WriteByte(7<<5 | byte(len(v)))
+		for k, val := range v {
+			b.Write(encode(k))
+			b.Write(encode(val))
+		}
+	case []any:
+		b.Write([]byte{byte(len(v)), 11 - 7})
+		for _, val := range v {
+			b.Write(encode(val))
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,292 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+const (
+	maxDepth  = 32      //嵌套/指针最大深度，防止自引用指针无限递归
+	maxValues = 1 << 16 //单次解码最大值个数，防止指针重复引用导致指数展开
+)
+
+var (
+	metaMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+)
+
+// MaxMind DB(mmdb)格式库，整体读入内存
+// 兼容GeoLite2-Country/GeoLite2-City等，取country及subdivisions/city名称
+type mmdb struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	lang       []string
+}
+
+func NewMMDB(file string, lang ...string) (Resolver, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return newMMDB(b, lang...)
+}
+
+func newMMDB(b []byte, lang ...string) (*mmdb, error) {
+	i := bytes.LastIndex(b, metaMarker)
+	if i < 0 {
+		return nil, ErrFormat
+	}
+	meta, ok := (&decoder{buf: b[i+len(metaMarker):]}).decode(0).(map[string]any)
+	if !ok {
+		return nil, ErrFormat
+	}
+	s := &mmdb{
+		buf:        b,
+		nodeCount:  toUint(meta["node_count"]),
+		recordSize: toUint(meta["record_size"]),
+		ipVersion:  toUint(meta["ip_version"]),
+		lang:       append(append([]string{}, lang...), "zh-CN", "en"),
+	}
+	switch s.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, ErrFormat
+	}
+	treeSize := s.recordSize * 2 / 8 * s.nodeCount
+	if treeSize+16 > uint(i) {
+		return nil, ErrFormat
+	}
+	s.data = b[treeSize+16 : i]
+	//IPv6库中IPv4位于::/96下
+	if s.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < s.nodeCount; j++ {
+			node = s.record(node, 0)
+		}
+		s.ipv4Start = node
+	}
+	return s, nil
+}
+
+// 读取节点左(0)右(1)记录
+func (s *mmdb) record(node uint, bit uint) uint {
+	switch s.recordSize {
+	case 24:
+		b := s.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := s.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(s.buf[node*8+bit*4:]))
+	}
+}
+
+func (s *mmdb) lookup(ip net.IP) any {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if s.ipVersion == 6 {
+			node = s.ipv4Start
+		}
+	} else if s.ipVersion == 4 {
+		return nil
+	}
+	for i := 0; i < len(ip)*8 && node < s.nodeCount; i++ {
+		bit := uint(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = s.record(node, bit)
+	}
+	if node <= s.nodeCount {
+		return nil
+	}
+	offset := node - s.nodeCount - 16
+	if offset >= uint(len(s.data)) {
+		return nil
+	}
+	return (&decoder{buf: s.data}).decode(offset)
+}
+
+func (s *mmdb) Lookup(ip net.IP) (region conn.Region, ok bool) {
+	if ip == nil {
+		return
+	}
+	record, _ := s.lookup(ip).(map[string]any)
+	if record == nil {
+		return
+	}
+	region.Country = s.name(record["country"])
+	if region.Country == "" {
+		region.Country = s.name(record["registered_country"])
+	}
+	if subdivisions, _ := record["subdivisions"].([]any); len(subdivisions) > 0 {
+		region.Location = s.name(subdivisions[0])
+	}
+	if city := s.name(record["city"]); city != "" {
+		if region.Location != "" && region.Location != city {
+			region.Location += " " + city
+		} else {
+			region.Location = city
+		}
+	}
+	ok = region.Country != "" || region.Location != ""
+	return
+}
+
+// 按语言取名称，无名称时取iso_code
+func (s *mmdb) name(v any) string {
+	m, _ := v.(map[string]any)
+	if m == nil {
+		return ""
+	}
+	if names, _ := m["names"].(map[string]any); names != nil {
+		for _, lang := range s.lang {
+			if name, ok := names[lang].(string); ok && name != "" {
+				return name
+			}
+		}
+	}
+	code, _ := m["iso_code"].(string)
+	return code
+}
+
+func (s *mmdb) Close() error {
+	s.buf = nil
+	s.data = nil
+	return nil
+}
+
+// mmdb数据段解码，超出深度或数量限制时返回nil
+type decoder struct {
+	buf    []byte
+	offset uint
+	depth  int
+	count  int
+}
+
+func (s *decoder) decode(offset uint) any {
+	s.offset = offset
+	return s.value()
+}
+
+// 越界时返回定长字段所需的零值，变长字段返回空
+func (s *decoder) next(n uint) []byte {
+	if s.offset+n > uint(len(s.buf)) {
+		s.offset = uint(len(s.buf))
+		if n > 8 {
+			return nil
+		}
+		return make([]byte, n)
+	}
+	b := s.buf[s.offset : s.offset+n]
+	s.offset += n
+	return b
+}
+
+func (s *decoder) value() any {
+	if s.depth >= maxDepth || s.count >= maxValues {
+		s.offset = uint(len(s.buf))
+		return nil
+	}
+	s.depth++
+	s.count++
+	defer func() {
+		s.depth--
+	}()
+	ctrl := uint(s.next(1)[0])
+	typ := ctrl >> 5
+	//指针
+	if typ == 1 {
+		ss, vvv := (ctrl>>3)&0x3, ctrl&0x7
+		var p uint
+		switch ss {
+		case 0:
+			p = vvv<<8 | uint(s.next(1)[0])
+		case 1:
+			b := s.next(2)
+			p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			b := s.next(3)
+			p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(s.next(4)))
+		}
+		offset := s.offset
+		v := s.decode(p)
+		s.offset = offset
+		return v
+	}
+	//扩展类型
+	if typ == 0 {
+		typ = 7 + uint(s.next(1)[0])
+	}
+	size := ctrl & 0x1f
+	switch size {
+	case 29:
+		size = 29 + uint(s.next(1)[0])
+	case 30:
+		b := s.next(2)
+		size = 285 + (uint(b[0])<<8 | uint(b[1]))
+	case 31:
+		b := s.next(3)
+		size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+	}
+	switch typ {
+	case 2:
+		return string(s.next(size))
+	case 3:
+		return math.Float64frombits(binary.BigEndian.Uint64(s.next(8)))
+	case 4:
+		return append([]byte{}, s.next(size)...)
+	case 5, 6, 9, 10:
+		var n uint64
+		for _, c := range s.next(size) {
+			n = n<<8 | uint64(c)
+		}
+		return n
+	case 7:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size && s.offset < uint(len(s.buf)); i++ {
+			k, _ := s.value().(string)
+			m[k] = s.value()
+		}
+		return m
+	case 8:
+		var n int32
+		for _, c := range s.next(size) {
+			n = n<<8 | int32(c)
+		}
+		return n
+	case 11:
+		a := make([]any, 0, size)
+		for i := uint(0); i < size && s.offset < uint(len(s.buf)); i++ {
+			a = append(a, s.value())
+		}
+		return a
+	case 14:
+		return size != 0
+	case 15:
+		return math.Float32frombits(binary.BigEndian.Uint32(s.next(4)))
+	}
+	return nil
+}
+
+func toUint(v any) uint {
+	switch v := v.(type) {
+	case uint64:
+		return uint(v)
+	case int32:
+		return uint(v)
+	}
+	return 0
+}
@@ -105,6 +105,8 @@ func (s *buckets) handler(msg any, args ...any) bool {
 		case Update:
 			cursor := arg.UpdateBucket(data.Peer(), data.Cursor(), s.Size())
 			data.Cb()(cursor)
+		case Remove:
+			arg.RemoveBucket(data.Peer())
 		}
 		data.Put()
 	case timer.Data:
@@ -19,6 +19,7 @@ type OpType uint8
 const (
 	Push OpType = iota + 10
 	Update
+	Remove
 )
 
 // 定时轮盘桶节点，处理空闲会话
@@ -54,6 +55,14 @@ func NewUpdateBucket(peer conn.Session, cursor int32, cb func(args ...any)) Data
 	return s
 }
 
+func NewRemoveBucket(peer conn.Session) Data {
+	s := t.Get().(*data)
+	s.op = Remove
+	s.peer = peer
+	s.cb = nil
+	return s
+}
+
 func (s *data) Peer() conn.Session {
 	return s.peer
 }
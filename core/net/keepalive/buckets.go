@@ -1,6 +1,7 @@
 package keepalive
 
 import (
+	"sync"
 	"time"
 
 	"github.com/cwloo/gonet/core/base/cc"
@@ -10,11 +11,64 @@ import (
 var (
 	flag    = cc.NewAtomFlag()
 	buckets bucket.Buckets
+	l       = &sync.Mutex{}
+	groups  = map[int32]bucket.Buckets{}
+	timeout time.Duration
+	tick    = time.Second
 )
 
-func Init(timeout, d time.Duration) {
+// 缺省空闲超时及检查间隔，只有首次调用生效，检查间隔按秒向上取整
+func Init(timeout_, d time.Duration) {
 	if flag.TestSet() {
-		second := int32(int64(timeout) / int64(time.Second))
-		buckets = bucket.NewBuckets(second, d)
+		second := seconds(timeout_)
+		if n := seconds(d); n > 0 {
+			d = time.Duration(n) * time.Second
+		} else {
+			d = time.Second
+		}
+		buckets = bucket.NewBuckets(size(second), d)
+		l.Lock()
+		timeout, tick = timeout_, d
+		groups[second] = buckets
+		l.Unlock()
 	}
 }
+
+// 缺省空闲超时
+func Timeout() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return timeout
+}
+
+// 超时秒数，不足1秒向上取整
+func seconds(d time.Duration) int32 {
+	if d <= 0 {
+		return 0
+	}
+	return int32((d + time.Second - 1) / time.Second)
+}
+
+// 轮盘大小，单个槽位的环形缓冲不可用，至少为2
+func size(second int32) int32 {
+	if second == 1 {
+		return 2
+	}
+	return second
+}
+
+// 按超时时间(秒)分组的定时轮盘池，共用首次Init的检查间隔，不存在时创建，<=0返回nil
+func group(d time.Duration) bucket.Buckets {
+	second := seconds(d)
+	if second <= 0 {
+		return nil
+	}
+	l.Lock()
+	defer l.Unlock()
+	g, ok := groups[second]
+	if !ok {
+		g = bucket.NewBuckets(size(second), tick)
+		groups[second] = g
+	}
+	return g
+}
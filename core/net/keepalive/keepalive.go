@@ -2,6 +2,7 @@ package keepalive
 
 import (
 	"sync"
+	"time"
 
 	"github.com/cwloo/gonet/core/base/pipe"
 	"github.com/cwloo/gonet/core/net/conn"
@@ -20,67 +21,108 @@ var (
 type Buckets interface {
 	Push(peer conn.Session)
 	Update(peer conn.Session)
+	SetTimeout(peer conn.Session, d time.Duration)
+	Timeout() time.Duration
 	Put()
 }
 
 type keepalive struct {
-	cursor int32
-	pipe   pipe.Pipe
+	l       sync.Mutex
+	cursor  int32
+	pipe    pipe.Pipe
+	timeout time.Duration
+	pushed  bool
 }
 
 func NewBuckets() Buckets {
 	s := t.Get().(*keepalive)
-	s.pipe = buckets.Next()
-	switch s.pipe {
-	case nil:
-	default:
+	s.l.Lock()
+	s.pipe = nil
+	if buckets != nil {
+		s.pipe = buckets.Next()
 	}
+	s.timeout = Timeout()
+	s.pushed = false
+	s.cursor = 0
+	s.l.Unlock()
 	return s
 }
 
+func (s *keepalive) next() (p pipe.Pipe) {
+	s.l.Lock()
+	p = s.pipe
+	s.l.Unlock()
+	return
+}
+
+func (s *keepalive) setCursor(args ...any) {
+	if len(args) > 0 {
+		if cursor, ok := args[0].(int32); ok {
+			if cursor > 0 {
+				s.l.Lock()
+				s.cursor = cursor
+				s.l.Unlock()
+			}
+		}
+	}
+}
+
+func (s *keepalive) Timeout() time.Duration {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.timeout
+}
+
+// 修改空闲超时，<=0不检查空闲，已加入轮盘时迁移到对应超时的轮盘
+func (s *keepalive) SetTimeout(peer conn.Session, d time.Duration) {
+	s.l.Lock()
+	if d == s.timeout {
+		s.l.Unlock()
+		return
+	}
+	old, pushed := s.pipe, s.pushed
+	s.timeout = d
+	s.pipe = nil
+	if g := group(d); g != nil {
+		s.pipe = g.Next()
+	}
+	p := s.pipe
+	s.l.Unlock()
+	if pushed {
+		if old != nil {
+			old.Do(bucket.NewRemoveBucket(peer))
+		}
+		if p != nil {
+			p.Do(bucket.NewPushBucket(peer, s.setCursor))
+		}
+	}
+}
+
 func (s *keepalive) Push(peer conn.Session) {
-	switch s.pipe {
+	s.l.Lock()
+	s.pushed = true
+	s.l.Unlock()
+	switch p := s.next(); p {
 	case nil:
 	default:
-		s.pipe.Do(
-			bucket.NewPushBucket(
-				peer,
-				func(args ...any) {
-					if len(args) > 0 {
-						if cursor, ok := args[0].(int32); ok {
-							if cursor > 0 {
-								s.cursor = cursor
-							}
-						}
-					}
-				}))
+		p.Do(bucket.NewPushBucket(peer, s.setCursor))
 	}
 }
 
 func (s *keepalive) Update(peer conn.Session) {
-	switch s.pipe {
+	s.l.Lock()
+	p, cursor := s.pipe, s.cursor
+	s.l.Unlock()
+	switch p {
 	case nil:
 	default:
-		s.pipe.Do(
-			bucket.NewUpdateBucket(
-				peer,
-				s.cursor,
-				func(args ...any) {
-					if len(args) > 0 {
-						if cursor, ok := args[0].(int32); ok {
-							if cursor > 0 {
-								s.cursor = cursor
-							}
-						}
-					}
-				}))
+		p.Do(bucket.NewUpdateBucket(peer, cursor, s.setCursor))
 	}
 }
 
 func (s *keepalive) Put() {
-	switch s.pipe {
-	case nil:
-	default:
-	}
+	s.l.Lock()
+	s.pushed = false
+	s.l.Unlock()
 	t.Put(s)
 }
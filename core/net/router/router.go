@@ -0,0 +1,109 @@
+package router
+
+import (
+	"encoding/binary"
+
+	"github.com/cwloo/gonet/core/base/run/event"
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/packet"
+	"github.com/cwloo/gonet/utils/timestamp"
+)
+
+// 命令路由，packet.Unpack解析帧后按mainID/subID分发
+// tcp须配合tcpchannel.NewFrameChannel(tcpchannel.KHeadPacket, ...)按帧读取
+// 处理函数须在服务启动前注册
+type Router struct {
+	order    binary.ByteOrder
+	handlers cb.CmdCallbacks
+	fallback cb.ReadCallback
+}
+
+func NewRouter(order binary.ByteOrder) *Router {
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	return &Router{order: order, handlers: cb.CmdCallbacks{}}
+}
+
+// 注册原始处理函数，msg为*packet.Msg
+func (s *Router) Handle(mainID, subID uint8, handler cb.CmdCallback) {
+	if handler == nil {
+		logs.Fatalf("error")
+	}
+	cmd := uint32(packet.Enword(int(mainID), int(subID)))
+	if _, ok := s.handlers[cmd]; ok {
+		logs.Fatalf("cmd %v:%v registered", mainID, subID)
+	}
+	s.handlers[cmd] = handler
+}
+
+// 未注册命令处理函数，msg为*packet.Msg
+func (s *Router) SetFallback(handler cb.ReadCallback) {
+	s.fallback = handler
+}
+
+// 注册类型化处理函数，按包头加密类型(packet.Codec)解码到*T
+func Register[T any](s *Router, mainID, subID uint8, handler func(peer conn.Session, req *T)) {
+	s.Handle(mainID, subID, func(msg any, peer conn.Session) {
+		m := msg.(*packet.Msg)
+		req := new(T)
+		err := packet.Unmarshal(m.EncType(), m.Data, req)
+		if err != nil {
+			logs.Errorf("cmd %v:%v %v", mainID, subID, err)
+			return
+		}
+		handler(peer, req)
+	})
+}
+
+// 读协程内直接分发，可作为cb.OnMessage
+func (s *Router) OnMessage(peer conn.Session, msg any, msgType int, recvTime timestamp.T) {
+	m := s.unpack(peer, msg)
+	if m != nil {
+		s.OnRead(m.Cmd(), m, peer)
+	}
+}
+
+// 读协程内解析，投递到事件处理单元(mailbox)分发
+// proc 按会话选择事件处理单元，同一会话应返回同一处理单元以保证消息顺序
+func (s *Router) PostTo(proc func(peer conn.Session) event.Proc) cb.OnMessage {
+	return func(peer conn.Session, msg any, msgType int, recvTime timestamp.T) {
+		m := s.unpack(peer, msg)
+		if m != nil {
+			proc(peer).PostReadWith(s.OnRead, m.Cmd(), m, peer)
+		}
+	}
+}
+
+// 分发，可作为cb.ReadCallback
+func (s *Router) OnRead(cmd uint32, msg any, peer conn.Session) {
+	if handler, ok := s.handlers[cmd]; ok {
+		handler(msg, peer)
+	} else if s.fallback != nil {
+		s.fallback(cmd, msg, peer)
+	} else {
+		mainID, subID := packet.Deword(int(cmd))
+		logs.Warnf("cmd %v:%v not found %v", mainID, subID, peer.RemoteAddr())
+	}
+}
+
+func (s *Router) unpack(peer conn.Session, msg any) *packet.Msg {
+	switch msg := msg.(type) {
+	case *packet.Msg:
+		return msg
+	case []byte:
+		m, err := packet.UnpackMsg(msg, s.order)
+		if err != nil {
+			//帧损坏后续无法对齐，关闭对端
+			logs.Errorf("%v %v", peer.RemoteAddr(), err)
+			peer.Close()
+			return nil
+		}
+		return m
+	default:
+		logs.Errorf("%v msg type", peer.RemoteAddr())
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package router_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/router"
+	"github.com/cwloo/gonet/utils/packet"
+	"github.com/cwloo/gonet/utils/timestamp"
+)
+
+type session struct {
+	conn.Session
+	closed int
+}
+
+func (s *session) RemoteAddr() string {
+	return "test"
+}
+
+func (s *session) Close() {
+	s.closed++
+}
+
+type Req struct {
+	Name string
+	N    int
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func pack(t *testing.T, mainID, subID uint8, v any) []byte {
+	msg, err := packet.NewWith(mainID, subID, packet.ENC_JSON_NONE, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := packet.Pack(msg, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDispatch(t *testing.T) {
+	r := router.NewRouter(binary.LittleEndian)
+	var got *Req
+	router.Register(r, 1, 2, func(peer conn.Session, req *Req) {
+		got = req
+	})
+	var fallback []uint32
+	r.SetFallback(func(cmd uint32, msg any, peer conn.Session) {
+		if _, ok := msg.(*packet.Msg); !ok {
+			t.Fatalf("fallback msg %T", msg)
+		}
+		fallback = append(fallback, cmd)
+	})
+	peer := &session{}
+	r.OnMessage(peer, pack(t, 1, 2, &Req{Name: "a", N: 3}), 0, timestamp.Now())
+	if got == nil || got.Name != "a" || got.N != 3 {
+		t.Fatalf("decode %+v", got)
+	}
+	//未注册命令
+	r.OnMessage(peer, pack(t, 1, 3, &Req{}), 0, timestamp.Now())
+	if len(fallback) != 1 || fallback[0] != uint32(packet.Enword(1, 3)) {
+		t.Fatalf("fallback %v", fallback)
+	}
+	//解码失败不调用处理函数
+	got = nil
+	r.OnMessage(peer, pack(t, 1, 2, "str"), 0, timestamp.Now())
+	if got != nil {
+		t.Fatal("handler called on decode error")
+	}
+	if peer.closed != 0 {
+		t.Fatal("closed on decode error")
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	r := router.NewRouter(binary.LittleEndian)
+	r.SetFallback(func(cmd uint32, msg any, peer conn.Session) {
+		t.Fatal("fallback called on corrupt frame")
+	})
+	peer := &session{}
+	b := pack(t, 1, 2, &Req{Name: "a"})
+	b[len(b)-1] ^= 0xFF
+	r.OnMessage(peer, b, 0, timestamp.Now())
+	r.OnMessage(peer, []byte{1, 2, 3}, 0, timestamp.Now())
+	if peer.closed != 2 {
+		t.Fatalf("closed %v", peer.closed)
+	}
+}
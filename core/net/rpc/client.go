@@ -0,0 +1,209 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cwloo/gonet/core/base/task"
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/packet"
+	"github.com/cwloo/gonet/utils/timestamp"
+)
+
+var (
+	ErrTimeout      = errors.New("rpc timeout")
+	ErrClosed       = errors.New("rpc peer closed")
+	ErrDisconnected = errors.New("rpc peer disconnected")
+)
+
+// ctx未设置deadline且未指定默认超时时使用
+const defaultTimeout = 10 * time.Second
+
+// 等待响应的请求
+type call struct {
+	peerID int64
+	ch     chan result
+}
+
+// 响应或结束原因
+type result struct {
+	msg *packet.Msg
+	err error
+}
+
+// RPC客户端，按ReqId关联请求/响应
+type Client struct {
+	order   binary.ByteOrder
+	encType uint8
+	d       time.Duration
+	reqID   uint32
+	l       *sync.Mutex
+	pending map[uint32]*call
+}
+
+// encType 请求编码类型(packet.ENC_xxx)
+// d 默认超时，ctx未设置deadline时生效，<=0取defaultTimeout
+// 由task定时任务池检查超时，精度为秒，按秒向上取整
+func NewClient(order binary.ByteOrder, encType uint8, d time.Duration) *Client {
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	if d <= 0 {
+		d = defaultTimeout
+	}
+	d = (d + time.Second - 1) / time.Second * time.Second
+	return &Client{
+		order:   order,
+		encType: encType,
+		d:       d,
+		l:       &sync.Mutex{},
+		pending: map[uint32]*call{},
+	}
+}
+
+func (s *Client) newReqID() (reqID uint32) {
+	for reqID == 0 {
+		reqID = atomic.AddUint32(&s.reqID, 1)
+	}
+	return
+}
+
+// 等待响应数
+func (s *Client) Pending() (c int) {
+	s.l.Lock()
+	c = len(s.pending)
+	s.l.Unlock()
+	return
+}
+
+// 同步调用，cmd为packet.Enword(mainID, subID)，resp为响应解码目标(指针)
+func (s *Client) Call(ctx context.Context, peer conn.Session, cmd uint32, req any, resp any) error {
+	mainID, subID := packet.Deword(int(cmd))
+	msg, err := packet.NewWith(uint8(mainID), uint8(subID), s.encType, req)
+	if err != nil {
+		return err
+	}
+	reqID := s.newReqID()
+	msg.SetReqID(reqID)
+	c := &call{peerID: peer.ID(), ch: make(chan result, 1)}
+	s.l.Lock()
+	s.pending[reqID] = c
+	s.l.Unlock()
+	//先登记再检查，避免与Cancel交错时漏掉断开通知
+	if !peer.Connected() {
+		s.done(reqID, result{err: ErrDisconnected})
+		return ErrDisconnected
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		//已结束的请求超时后忽略
+		task.After(s.d, cb.NewFunctor00(func() {
+			s.done(reqID, result{err: ErrTimeout})
+		}))
+	}
+	peer.Write(msg)
+	select {
+	case rsp := <-c.ch:
+		switch rsp.err {
+		case nil:
+			if resp == nil {
+				return nil
+			}
+			return packet.Unmarshal(rsp.msg.EncType(), rsp.msg.Data, resp)
+		default:
+			return rsp.err
+		}
+	case <-ctx.Done():
+		s.done(reqID, result{err: ctx.Err()})
+		return ctx.Err()
+	}
+}
+
+// 结束等待
+func (s *Client) done(reqID uint32, rsp result) bool {
+	s.l.Lock()
+	c, ok := s.pending[reqID]
+	if ok {
+		delete(s.pending, reqID)
+	}
+	s.l.Unlock()
+	if ok {
+		c.ch <- rsp
+	}
+	return ok
+}
+
+// 处理响应，返回false表示非等待中的响应
+func (s *Client) Reply(msg *packet.Msg) bool {
+	if msg.ReqID() == 0 {
+		return false
+	}
+	return s.done(msg.ReqID(), result{msg: msg})
+}
+
+// 对端断开，结束该会话全部等待
+func (s *Client) Cancel(peer conn.Session) {
+	s.l.Lock()
+	calls := []*call{}
+	for reqID, c := range s.pending {
+		if c.peerID == peer.ID() {
+			delete(s.pending, reqID)
+			calls = append(calls, c)
+		}
+	}
+	s.l.Unlock()
+	for _, c := range calls {
+		c.ch <- result{err: ErrClosed}
+	}
+}
+
+// 包装cb.OnMessage，先匹配响应，其余消息以*packet.Msg交给next
+func (s *Client) OnMessage(next cb.OnMessage) cb.OnMessage {
+	return func(peer conn.Session, msg any, msgType int, recvTime timestamp.T) {
+		m, ok := msg.(*packet.Msg)
+		if !ok {
+			b, ok := msg.([]byte)
+			if !ok {
+				logs.Errorf("%v msg type", peer.RemoteAddr())
+				return
+			}
+			var err error
+			m, err = packet.UnpackMsg(b, s.order)
+			if err != nil {
+				logs.Errorf("%v %v", peer.RemoteAddr(), err)
+				return
+			}
+		}
+		if s.Reply(m) {
+			return
+		}
+		if next != nil {
+			next(peer, m, msgType, recvTime)
+		}
+	}
+}
+
+// 包装cb.OnClosed，结束该会话全部等待
+func (s *Client) OnClosed(next cb.OnClosed) cb.OnClosed {
+	return func(peer conn.Session, reason conn.Reason, v ...any) {
+		s.Cancel(peer)
+		if next != nil {
+			next(peer, reason, v...)
+		}
+	}
+}
+
+// 同步调用，返回*T响应
+func Invoke[T any](ctx context.Context, s *Client, peer conn.Session, cmd uint32, req any) (*T, error) {
+	resp := new(T)
+	err := s.Call(ctx, peer, cmd, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
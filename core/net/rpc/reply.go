@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/router"
+	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/packet"
+)
+
+// 服务端响应，沿用请求的mainID/subID/加密类型/ReqId
+func Reply(peer conn.Session, req *packet.Msg, resp any) error {
+	return ReplyWith(peer, req, req.MainID(), req.SubID(), resp)
+}
+
+// 服务端响应，指定响应mainID/subID，沿用请求的加密类型/ReqId
+func ReplyWith(peer conn.Session, req *packet.Msg, mainID, subID uint8, resp any) error {
+	msg, err := packet.NewWith(mainID, subID, req.EncType(), resp)
+	if err != nil {
+		return err
+	}
+	msg.SetReqID(req.ReqID())
+	peer.Write(msg)
+	return nil
+}
+
+// 注册服务端请求处理函数，返回值自动按请求ReqId响应
+// 处理函数返回error时不响应，调用方超时
+func Register[T any, R any](r *router.Router, mainID, subID uint8, handler func(peer conn.Session, req *T) (*R, error)) {
+	r.Handle(mainID, subID, func(msg any, peer conn.Session) {
+		m := msg.(*packet.Msg)
+		req := new(T)
+		err := packet.Unmarshal(m.EncType(), m.Data, req)
+		if err != nil {
+			logs.Errorf("cmd %v:%v %v", mainID, subID, err)
+			return
+		}
+		resp, err := handler(peer, req)
+		if err != nil {
+			logs.Errorf("cmd %v:%v %v", mainID, subID, err)
+			return
+		}
+		err = Reply(peer, m, resp)
+		if err != nil {
+			logs.Errorf("cmd %v:%v %v", mainID, subID, err)
+		}
+	})
+}
@@ -0,0 +1,426 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	arqPush      byte = 0x11 //可靠数据
+	arqAck       byte = 0x12 //确认
+	arqFin       byte = 0x13 //关闭，与数据一起可靠有序发送
+	arqHeadLen        = 17   //cmd(1)+wnd(2)+ts(4)+sn(4)+una(4)+len(2)
+	arqMSS            = udpMTU - arqHeadLen
+	arqWnd            = 256        //收发窗口(分片数)
+	arqSndLimit       = 4 * arqWnd //待发送+待确认分片上限，超过时Write阻塞
+	arqInterval       = 10 * time.Millisecond
+	arqMinRTO         = 30 * time.Millisecond
+	arqMaxRTO         = 60 * time.Second
+	arqFastAck        = 3  //快速重传
+	arqFastLimit      = 5  //快速重传次数上限
+	arqDeadLink       = 20 //重传次数上限
+)
+
+// 发送分片
+type segment struct {
+	sn      uint32
+	data    []byte
+	ts      uint32
+	resend  time.Time
+	rto     time.Duration
+	xmit    int
+	fastack int
+	fin     bool
+}
+
+type ack struct {
+	sn uint32
+	ts uint32
+}
+
+// 可靠传输层(ARQ)，序号/累计确认/选择确认/超时及快速重传/拥塞窗口
+type arq struct {
+	l        *sync.Mutex
+	cond     *sync.Cond
+	c        *udpConn
+	start    time.Time
+	sndNxt   uint32
+	rcvNxt   uint32
+	sndQueue []*segment
+	sndBuf   []*segment
+	rcvBuf   map[uint32][]byte
+	finSn    uint32
+	finRcv   bool
+	closing  bool
+	acks     []ack
+	rmtWnd   int
+	cwnd     float64
+	ssthresh int
+	srtt     time.Duration
+	rttvar   time.Duration
+	rto      time.Duration
+	dead     bool
+	done     chan struct{}
+}
+
+func newARQ(c *udpConn) *arq {
+	s := &arq{
+		l:        &sync.Mutex{},
+		c:        c,
+		start:    time.Now(),
+		rcvBuf:   map[uint32][]byte{},
+		rmtWnd:   arqWnd,
+		cwnd:     1,
+		ssthresh: arqWnd / 2,
+		rto:      200 * time.Millisecond,
+		done:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(s.l)
+	go s.run()
+	return s
+}
+
+func (s *arq) now() uint32 {
+	return uint32(time.Since(s.start) / time.Millisecond)
+}
+
+func before(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func (s *arq) run() {
+	ticker := time.NewTicker(arqInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.l.Lock()
+			s.flush()
+			dead := s.dead
+			if dead {
+				s.cond.Broadcast()
+			}
+			s.l.Unlock()
+			if dead {
+				//对端不可达
+				s.c.shutdown()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *arq) stop() {
+	s.l.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.cond.Broadcast()
+	s.l.Unlock()
+}
+
+func (s *arq) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// FIN排在已发送数据之后
+func (s *arq) close() {
+	s.l.Lock()
+	if !s.closing {
+		s.closing = true
+		s.sndQueue = append(s.sndQueue, &segment{sn: s.sndNxt, fin: true})
+		s.sndNxt++
+		s.flush()
+		s.cond.Broadcast()
+	}
+	s.l.Unlock()
+}
+
+// 等待已发送数据全部确认，d内无确认进展时放弃
+func (s *arq) linger(d time.Duration) {
+	last, deadline := -1, time.Time{}
+	for {
+		s.l.Lock()
+		n := len(s.sndQueue) + len(s.sndBuf)
+		dead := s.dead
+		s.l.Unlock()
+		if n == 0 || dead {
+			return
+		}
+		now := time.Now()
+		switch {
+		case n != last:
+			last, deadline = n, now.Add(d)
+		case !now.Before(deadline):
+			return
+		}
+		time.Sleep(arqInterval)
+	}
+}
+
+// 分片入发送队列，超过arqSndLimit时阻塞等待确认
+func (s *arq) send(b []byte) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for len(b) > 0 {
+		for len(s.sndQueue)+len(s.sndBuf) >= arqSndLimit && !s.dead && !s.closing && !s.stopped() {
+			s.cond.Wait()
+		}
+		if s.dead || s.closing || s.stopped() {
+			return net.ErrClosed
+		}
+		n := len(b)
+		if n > arqMSS {
+			n = arqMSS
+		}
+		s.sndQueue = append(s.sndQueue, &segment{sn: s.sndNxt, data: append([]byte{}, b[:n]...)})
+		s.sndNxt++
+		b = b[n:]
+		s.flush()
+	}
+	return nil
+}
+
+func (s *arq) input(pkt []byte) {
+	s.l.Lock()
+	now := s.now()
+	pending := len(s.sndQueue) + len(s.sndBuf)
+	acked, maxack := false, uint32(0)
+	for len(pkt) >= arqHeadLen {
+		cmd := pkt[0]
+		wnd := int(binary.LittleEndian.Uint16(pkt[1:]))
+		ts := binary.LittleEndian.Uint32(pkt[3:])
+		sn := binary.LittleEndian.Uint32(pkt[7:])
+		una := binary.LittleEndian.Uint32(pkt[11:])
+		n := int(binary.LittleEndian.Uint16(pkt[15:]))
+		if len(pkt) < arqHeadLen+n {
+			break
+		}
+		data := pkt[arqHeadLen : arqHeadLen+n]
+		pkt = pkt[arqHeadLen+n:]
+		s.rmtWnd = wnd
+		s.ackUna(una)
+		switch cmd {
+		case arqAck:
+			if before(now, ts) {
+				break
+			}
+			s.updateRTO(time.Duration(now-ts) * time.Millisecond)
+			s.ackSn(sn)
+			if !acked || before(maxack, sn) {
+				acked, maxack = true, sn
+			}
+		case arqPush, arqFin:
+			if !before(sn, s.rcvNxt+arqWnd) {
+				break
+			}
+			s.acks = append(s.acks, ack{sn: sn, ts: ts})
+			if !before(sn, s.rcvNxt) && cmd == arqFin {
+				s.finSn, s.finRcv = sn, true
+			} else if !before(sn, s.rcvNxt) {
+				if _, ok := s.rcvBuf[sn]; !ok {
+					s.rcvBuf[sn] = append([]byte{}, data...)
+				}
+			}
+		}
+	}
+	if acked {
+		s.fastAck(maxack)
+	}
+	//按序交付，FIN之后对端不再发送
+	for {
+		if s.finRcv && s.finSn == s.rcvNxt {
+			s.finRcv = false
+			s.rcvNxt++
+			s.c.shutdown()
+			break
+		}
+		data, ok := s.rcvBuf[s.rcvNxt]
+		if !ok {
+			break
+		}
+		delete(s.rcvBuf, s.rcvNxt)
+		s.rcvNxt++
+		s.c.deliver(data)
+	}
+	if len(s.sndQueue)+len(s.sndBuf) < pending {
+		s.cond.Broadcast()
+	}
+	s.flush()
+	s.l.Unlock()
+}
+
+// 累计确认
+func (s *arq) ackUna(una uint32) {
+	i := 0
+	for ; i < len(s.sndBuf) && before(s.sndBuf[i].sn, una); i++ {
+		s.grow()
+	}
+	s.sndBuf = s.sndBuf[i:]
+}
+
+// 选择确认
+func (s *arq) ackSn(sn uint32) {
+	for i, seg := range s.sndBuf {
+		if seg.sn == sn {
+			s.sndBuf = append(s.sndBuf[:i], s.sndBuf[i+1:]...)
+			s.grow()
+			return
+		}
+		if before(sn, seg.sn) {
+			return
+		}
+	}
+}
+
+// 每批确认一次，最大确认序号之前的分片累计快速重传计数
+func (s *arq) fastAck(sn uint32) {
+	for _, seg := range s.sndBuf {
+		if !before(seg.sn, sn) {
+			return
+		}
+		seg.fastack++
+	}
+}
+
+// 慢启动/拥塞避免
+func (s *arq) grow() {
+	if int(s.cwnd) < s.ssthresh {
+		s.cwnd++
+	} else {
+		s.cwnd += 1 / s.cwnd
+	}
+	if s.cwnd > float64(arqWnd) {
+		s.cwnd = float64(arqWnd)
+	}
+}
+
+// RFC6298
+func (s *arq) updateRTO(rtt time.Duration) {
+	if s.srtt == 0 {
+		s.srtt = rtt
+		s.rttvar = rtt / 2
+	} else {
+		delta := s.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		s.rttvar = (3*s.rttvar + delta) / 4
+		s.srtt = (7*s.srtt + rtt) / 8
+	}
+	rto := s.srtt + 4*s.rttvar
+	if rto < s.srtt+arqInterval {
+		rto = s.srtt + arqInterval
+	}
+	if rto < arqMinRTO {
+		rto = arqMinRTO
+	}
+	if rto > arqMaxRTO {
+		rto = arqMaxRTO
+	}
+	s.rto = rto
+}
+
+// 乱序缓冲及未读数据均占用接收窗口
+func (s *arq) wnd() int {
+	if n := arqWnd - len(s.rcvBuf) - s.c.buffered()/arqMSS; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// 发送确认及窗口内分片
+func (s *arq) flush() {
+	buf := make([]byte, 0, udpMTU)
+	rwnd := s.wnd()
+	write := func(cmd byte, ts, sn uint32, data []byte) {
+		if len(buf)+arqHeadLen+len(data) > udpMTU {
+			s.c.output(buf)
+			buf = make([]byte, 0, udpMTU)
+		}
+		var h [arqHeadLen]byte
+		h[0] = cmd
+		binary.LittleEndian.PutUint16(h[1:], uint16(rwnd))
+		binary.LittleEndian.PutUint32(h[3:], ts)
+		binary.LittleEndian.PutUint32(h[7:], sn)
+		binary.LittleEndian.PutUint32(h[11:], s.rcvNxt)
+		binary.LittleEndian.PutUint16(h[15:], uint16(len(data)))
+		buf = append(append(buf, h[:]...), data...)
+	}
+	for _, a := range s.acks {
+		write(arqAck, a.ts, a.sn, nil)
+	}
+	s.acks = s.acks[:0]
+	//发送窗口
+	wnd := int(s.cwnd)
+	if wnd > s.rmtWnd {
+		wnd = s.rmtWnd
+	}
+	if wnd < 1 {
+		wnd = 1
+	}
+	for len(s.sndQueue) > 0 && len(s.sndBuf) < wnd {
+		s.sndBuf = append(s.sndBuf, s.sndQueue[0])
+		s.sndQueue = s.sndQueue[1:]
+	}
+	now := time.Now()
+	lost, fast := false, false
+	for _, seg := range s.sndBuf {
+		switch {
+		case seg.xmit == 0:
+			seg.rto = s.rto
+		case !now.Before(seg.resend):
+			lost = true
+			seg.rto += seg.rto / 2
+			if seg.rto > arqMaxRTO {
+				seg.rto = arqMaxRTO
+			}
+			if seg.xmit >= arqDeadLink {
+				s.dead = true
+			}
+		case seg.fastack >= arqFastAck && seg.xmit <= arqFastLimit:
+			fast = true
+		default:
+			continue
+		}
+		seg.xmit++
+		seg.fastack = 0
+		seg.ts = s.now()
+		seg.resend = now.Add(seg.rto)
+		if seg.fin {
+			write(arqFin, seg.ts, seg.sn, nil)
+		} else {
+			write(arqPush, seg.ts, seg.sn, seg.data)
+		}
+	}
+	if len(buf) > 0 {
+		s.c.output(buf)
+	}
+	//拥塞控制
+	inflight := len(s.sndBuf)
+	if fast {
+		s.ssthresh = inflight / 2
+		if s.ssthresh < 2 {
+			s.ssthresh = 2
+		}
+		s.cwnd = float64(s.ssthresh + arqFastAck)
+	}
+	if lost {
+		s.ssthresh = inflight / 2
+		if s.ssthresh < 2 {
+			s.ssthresh = 2
+		}
+		s.cwnd = 1
+	}
+}
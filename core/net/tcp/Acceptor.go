@@ -1,16 +1,23 @@
 package tcp
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/cwloo/gonet/core/base/cc"
 	"github.com/cwloo/gonet/core/base/pool/connpool"
 	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/acl"
 	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/geoip"
 	"github.com/cwloo/gonet/core/net/transmit"
 	logs "github.com/cwloo/gonet/logs"
 
@@ -21,9 +28,12 @@ import (
 type Acceptor interface {
 	Addr() *conn.Address
 	ListenTCP(address ...string)
+	Listen(address ...string) error
 	Stop()
 	GetIdleTimeout() time.Duration
 	SetCertFile(certfile, keyfile string)
+	SetClientCAFile(cafile string, required bool) error
+	ReloadCertificate() error
 	SetProtocolCallback(cb cb.OnProtocol)
 	SetVerifyCallback(cb cb.OnVerify)
 	SetConditionCallback(cb cb.OnCondition)
@@ -31,10 +41,29 @@ type Acceptor interface {
 	SetHandshakeTimeout(d time.Duration)
 	SetIdleTimeout(d time.Duration)
 	SetReadBufferSize(readBufferSize int)
+	SetWSOptions(opt *WSOptions)
+	HandleRoute(route *Route)
+	SetSniffing(enable bool)
+	Handle(pattern string, handler http.Handler)
+	SetMaxConnections(n int)
+	SetMaxConnectionsPerIP(n int)
+	SetAcceptRate(rate float64, burst int)
+	SetRejectCallback(cb cb.OnReject)
+	SetRegionResolver(r geoip.Resolver)
+	SetProxyProtocol(enable bool)
+	SetUnixFileMode(mode os.FileMode)
+	SetTrustedProxies(cidr ...string) error
+	Rejected(id conn.RejectID) int64
+	Connections() int
+	Release(peerAddr string)
 }
 
 type acceptor struct {
 	certfile, keyfile string
+	cert              *certificate
+	clientCAs         *x509.CertPool
+	clientAuth        tls.ClientAuthType
+	tlsConfig         *tls.Config
 	name              string
 	started           bool
 	listening         bool
@@ -45,19 +74,38 @@ type acceptor struct {
 	lock              *sync.Mutex
 	cond              *sync.Cond
 	addr              *conn.Address
+	err               error
 	upgrader          *websocket.Upgrader
+	wsOptions         *WSOptions
+	routes            []*Route
+	handlers          []handler
 	server            *http.Server
 	listener          net.Listener
 	channel           transmit.Channel
+	wsChannel         transmit.Channel
+	sniffing          bool
+	sniffer           *sniffListener
 	onProtocol        cb.OnProtocol
 	onVerify          cb.OnVerify
 	onCondition       cb.OnCondition
 	onNewConnection   cb.OnNewConnection
+	onReject          cb.OnReject
+	limiter           *limiter
+	resolver          geoip.Resolver
+	proxyProtocol     bool
+	trustedProxies    acl.ACL
+	fileMode          os.FileMode
 	handshakeTimeout  time.Duration
 	idleTimeout       time.Duration
 	readBufferSize    int
 }
 
+// HTTP路由
+type handler struct {
+	pattern string
+	handler http.Handler
+}
+
 func NewAcceptor(name string, address ...string) Acceptor {
 	s := &acceptor{
 		name:     name,
@@ -65,9 +113,10 @@ func NewAcceptor(name string, address ...string) Acceptor {
 		stopping: cc.NewSingal(),
 		closing:  [2]cc.AtomFlag{cc.NewAtomFlag(), cc.NewAtomFlag()},
 		flag:     [2]cc.AtomFlag{cc.NewAtomFlag(), cc.NewAtomFlag()},
+		limiter:  newLimiter(),
 	}
 	if len(address) > 0 {
-		s.addr = conn.ParseAddress(address[0])
+		s.addr, s.err = conn.ParseAddress(address[0])
 	}
 	s.cond = sync.NewCond(s.lock)
 	return s
@@ -89,6 +138,48 @@ func (s *acceptor) SetReadBufferSize(readBufferSize int) {
 	s.readBufferSize = readBufferSize
 }
 
+// websocket压缩/消息大小/Origin/子协议，须在ListenTCP前设置
+func (s *acceptor) SetWSOptions(opt *WSOptions) {
+	s.wsOptions = opt
+}
+
+// tcp监听时按首字节嗅探协议，HTTP/TLS按websocket处理，其余按tcp处理，须在ListenTCP前设置
+// 设置证书时TLS连接按wss处理
+func (s *acceptor) SetSniffing(enable bool) {
+	s.sniffing = enable
+}
+
+// websocket路由，须在ListenTCP前设置，路径不可重复
+func (s *acceptor) HandleRoute(route *Route) {
+	if s.registered(route.Path) {
+		logs.Fatalf("error")
+	}
+	s.routes = append(s.routes, route)
+}
+
+// 同端口普通HTTP处理，如/healthz、/metrics，须在ListenTCP前设置，路径不可重复
+func (s *acceptor) Handle(pattern string, h http.Handler) {
+	if s.registered(pattern) {
+		logs.Fatalf("error")
+	}
+	s.handlers = append(s.handlers, handler{pattern: pattern, handler: h})
+}
+
+// 路径已注册，重复注册时ServeMux会panic
+func (s *acceptor) registered(pattern string) bool {
+	for _, route := range s.routes {
+		if route.Path == pattern {
+			return true
+		}
+	}
+	for _, h := range s.handlers {
+		if h.pattern == pattern {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *acceptor) toName() {
 	s.name = s.name + "#" + s.addr.Format() + ".acceptor"
 }
@@ -97,11 +188,53 @@ func (s *acceptor) Addr() *conn.Address {
 	return s.addr
 }
 
+// wss/tls/tcps证书，文件修改后自动重新加载
 func (s *acceptor) SetCertFile(certfile, keyfile string) {
 	s.certfile = certfile
 	s.keyfile = keyfile
 }
 
+// 双向认证，校验客户端证书
+// required为true时要求客户端必须提供证书，否则仅校验已提供的证书
+func (s *acceptor) SetClientCAFile(cafile string, required bool) error {
+	pool, err := loadCertPool(cafile)
+	if err != nil {
+		return err
+	}
+	s.clientCAs = pool
+	switch required {
+	case true:
+		s.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		s.clientAuth = tls.VerifyClientCertIfGiven
+	}
+	return nil
+}
+
+// 立即重新加载证书
+func (s *acceptor) ReloadCertificate() error {
+	if s.cert == nil {
+		return ErrNoCertificate
+	}
+	return s.cert.load()
+}
+
+func (s *acceptor) newTLSConfig() (*tls.Config, error) {
+	if s.certfile == "" || s.keyfile == "" {
+		return nil, ErrNoCertificate
+	}
+	cert, err := newCertificate(s.certfile, s.keyfile)
+	if err != nil {
+		return nil, err
+	}
+	s.cert = cert
+	return &tls.Config{
+		GetCertificate: cert.get,
+		ClientCAs:      s.clientCAs,
+		ClientAuth:     s.clientAuth,
+	}, nil
+}
+
 func (s *acceptor) SetProtocolCallback(cb cb.OnProtocol) {
 	s.onProtocol = cb
 }
@@ -118,6 +251,139 @@ func (s *acceptor) SetNewConnectionCallback(cb cb.OnNewConnection) {
 	s.onNewConnection = cb
 }
 
+// 最大连接数，n<=0不限制
+func (s *acceptor) SetMaxConnections(n int) {
+	s.limiter.setMaxConns(n)
+}
+
+// 单IP最大连接数，n<=0不限制
+func (s *acceptor) SetMaxConnectionsPerIP(n int) {
+	s.limiter.setMaxPerIP(n)
+}
+
+// 令牌桶接受速率(每秒)，rate<=0不限制
+func (s *acceptor) SetAcceptRate(rate float64, burst int) {
+	s.limiter.setRate(rate, burst)
+}
+
+func (s *acceptor) SetRejectCallback(cb cb.OnReject) {
+	s.onReject = cb
+}
+
+// 地区解析，OnCondition前填充peerRegion
+func (s *acceptor) SetRegionResolver(r geoip.Resolver) {
+	s.resolver = r
+}
+
+// 启用PROXY protocol v1/v2，须在ListenTCP前设置
+// 仅解析SetTrustedProxies可信代理的头部，未设置可信代理时全部按直连处理
+func (s *acceptor) SetProxyProtocol(enable bool) {
+	s.proxyProtocol = enable
+}
+
+// unix socket文件权限，0不修改
+func (s *acceptor) SetUnixFileMode(mode os.FileMode) {
+	s.fileMode = mode
+}
+
+// 可信代理CIDR列表，用于PROXY protocol及websocket X-Forwarded-For
+func (s *acceptor) SetTrustedProxies(cidr ...string) error {
+	trusted := acl.NewACL(s.name)
+	if err := trusted.Allow(cidr...); err != nil {
+		return err
+	}
+	s.trustedProxies = trusted
+	return nil
+}
+
+// 未设置可信代理时全部不可信，设置后unix对端为本机进程不做检查
+func (s *acceptor) trusted(peerAddr net.Addr) bool {
+	switch {
+	case s.trustedProxies == nil:
+		return false
+	case s.addr.Proto == "unix":
+		return true
+	}
+	ip := geoip.IPOf(peerAddr)
+	return ip != nil && s.trustedProxies.Check(ip)
+}
+
+// 可信代理转发的websocket请求，取X-Forwarded-For中最右侧非可信代理地址改写r.RemoteAddr
+func (s *acceptor) forwarded(r *http.Request) {
+	xff := r.Header.Values("X-Forwarded-For")
+	if s.trustedProxies == nil || len(xff) == 0 {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !s.trustedProxies.Check(ip) {
+		return
+	}
+	addrs := strings.Split(strings.Join(xff, ","), ",")
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+		if ip == nil {
+			return
+		}
+		if !s.trustedProxies.Check(ip) {
+			r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			return
+		}
+	}
+}
+
+// 解析对端地区
+func (s *acceptor) region(peerAddr net.Addr) (peerRegion conn.Region) {
+	if s.resolver != nil {
+		if ip := geoip.IPOf(peerAddr); ip != nil {
+			peerRegion, _ = s.resolver.Lookup(ip)
+		}
+	}
+	return
+}
+
+// 拒绝接入计数
+func (s *acceptor) Rejected(id conn.RejectID) int64 {
+	return s.limiter.rejectedOf(id)
+}
+
+// 已接入连接数
+func (s *acceptor) Connections() int {
+	return s.limiter.connections()
+}
+
+// 连接关闭，释放接入计数
+func (s *acceptor) Release(peerAddr string) {
+	s.limiter.release(peerAddr)
+}
+
+// 接入检查
+func (s *acceptor) admit(peerAddr string) bool {
+	reject := s.limiter.admit(peerAddr)
+	if reject.Id == conn.KNoReject {
+		return true
+	}
+	s.reject(peerAddr, reject)
+	return false
+}
+
+// 拒绝接入
+func (s *acceptor) reject(peerAddr string, reject conn.Reject) {
+	s.limiter.count(reject.Id)
+	if s.onReject != nil {
+		s.onReject(peerAddr, reject)
+	}
+}
+
+// 已接入连接被拒绝
+func (s *acceptor) refuse(peerAddr string, reject conn.Reject) {
+	s.limiter.release(peerAddr)
+	s.reject(peerAddr, reject)
+}
+
 func (s *acceptor) assertProtocol() {
 	if s.onProtocol == nil {
 		panic(errors.New("error"))
@@ -136,50 +402,117 @@ func (s *acceptor) assertOnNewConnection() {
 // 	}
 // }
 
+// 监听并阻塞至Stop，错误由日志通知
 func (s *acceptor) ListenTCP(address ...string) {
+	s.Listen(address...)
+}
+
+// 同ListenTCP，地址解析或监听失败时返回错误
+func (s *acceptor) Listen(address ...string) (err error) {
 	s.assertProtocol()
 	// s.assertOnCondition()
 	s.assertOnNewConnection()
 	if len(address) > 0 {
-		s.addr = conn.ParseAddress(address[0])
+		//解析失败保留原地址
+		addr, err := conn.ParseAddress(address[0])
+		if err != nil {
+			logs.Errorf(err.Error())
+			return err
+		}
+		s.addr, s.err = addr, nil
+	}
+	if s.err != nil {
+		logs.Errorf(s.err.Error())
+		return s.err
 	}
 	if s.addr != nil && !s.started && s.flag[0].TestSet() {
 		s.close()
-		s.listenTCP()
+		err = s.listenTCP()
 		s.flag[0].Reset()
 	}
+	return
 }
 
 func (s *acceptor) Stop() {
 	if s.started && s.flag[1].TestSet() {
-		if s.server != nil {
+		server, sniffer := s.server, s.sniffer
+		if server != nil {
 			s.stop_serve()
-		} else {
+		}
+		//嗅探模式同时停止tcp accept
+		if server == nil || sniffer != nil {
 			s.stop_accept()
 		}
 		s.flag[1].Reset()
 	}
 }
 
-func (s *acceptor) listenTCP() {
+func (s *acceptor) listenTCP() error {
 	// logs.Warnf("addr=%v", s.addr.Addr)
 	s.toName()
-	listener, err := net.Listen("tcp", s.addr.Addr)
+	switch s.addr.Proto {
+	case "wss", "tcp":
+		//未设置证书时由前端终止TLS，tcp仅嗅探时使用证书
+		if s.certfile == "" || s.keyfile == "" || (s.addr.Proto == "tcp" && !s.sniffing) {
+			break
+		}
+		fallthrough
+	case "tls", "tcps":
+		config, err := s.newTLSConfig()
+		if err != nil {
+			logs.Errorf(err.Error())
+			return err
+		}
+		s.tlsConfig = config
+	}
+	var listener net.Listener
+	var err error
+	switch s.addr.Proto {
+	case "unix":
+		//清理残留socket文件
+		if err = removeStaleSocket(s.addr.Addr); err == nil {
+			listener, err = net.Listen("unix", s.addr.Addr)
+		}
+	case "udp", "kcp":
+		listener, err = listenUDP(s.addr.Addr, s.addr.Proto == "kcp")
+	default:
+		listener, err = net.Listen("tcp", s.addr.Addr)
+	}
 	if err != nil {
-		logs.Errorf(err.Error())
-		return
+		logs.Errorf("%v %v", s.addr.Addr, err)
+		return err
+	}
+	if s.addr.Proto == "unix" && s.fileMode != 0 && !isAbstract(s.addr.Addr) {
+		if err := os.Chmod(s.addr.Addr, s.fileMode); err != nil {
+			logs.Errorf(err.Error())
+		}
 	}
 	s.listener = listener
 	s.listening = true
+	if s.proxyProtocol {
+		switch s.addr.Proto {
+		case "ws", "wss":
+			s.listener = &proxyListener{Listener: listener, s: s}
+		}
+	}
 	s.channel = s.onProtocol(s.addr.Proto)
+	s.wsChannel = s.channel
 	logs.Debugf("%s", s.addr.Format())
+	if s.sniffing && s.addr.Proto == "tcp" {
+		s.sniffer = newSniffListener(s.listener)
+		s.wsChannel = s.onProtocol("ws")
+		go s.accept()
+		s.upgradeAndServe(&conn.Address{Proto: "ws", Addr: s.addr.Addr, Path: "/"})
+		return nil
+	}
 	switch s.addr.Proto {
 	case "ws", "wss":
 		s.upgradeAndServe(s.addr)
-	case "tcp":
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
 		go s.accept()
 		s.wait()
 	}
+	return nil
 }
 
 func (s *acceptor) accept() {
@@ -189,6 +522,10 @@ func (s *acceptor) accept() {
 	for !s.is_stopping() {
 		c, err := s.listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				//listener已关闭
+				break
+			}
 			if _, ok := err.(net.Error); ok /* && ne.Temporary()*/ {
 				if delay == 0 {
 					delay = 5 * time.Millisecond
@@ -205,78 +542,249 @@ func (s *acceptor) accept() {
 			logs.Errorf(err.Error())
 			return
 		}
-		switch conn.UsePool {
-		case true:
-			connpool.Do(cb.NewFunctor00(func() {
-				peerRegion := conn.Region{}
-				if s.onCondition != nil && !s.onCondition(c.RemoteAddr(), &peerRegion) {
-					c.Close()
-				} else if s.onNewConnection != nil {
-					s.onNewConnection(c, s.channel, s.addr.Proto, &peerRegion)
-				} else {
-					c.Close()
-				}
-			}))
-		default:
-			peerRegion := conn.Region{}
-			if s.onCondition != nil && !s.onCondition(c.RemoteAddr(), &peerRegion) {
+		proxied := s.proxyProtocol && s.trusted(c.RemoteAddr())
+		if s.sniffer != nil {
+			go s.sniff(c, proxied)
+			continue
+		}
+		if proxied || s.tlsConfig != nil {
+			//PROXY头部/TLS握手在独立协程中处理，避免阻塞accept
+			go s.handshake(c, proxied)
+			continue
+		}
+		s.newConnection(c)
+	}
+	if s.sniffer != nil {
+		s.sniffer.Close()
+	}
+	s.cleanup()
+}
+
+// 嗅探首字节，HTTP/TLS交给websocket服务
+// 嗅探前先做接入检查，避免不发数据的连接绕过限制，websocket在升级前重新检查
+func (s *acceptor) sniff(c net.Conn, proxied bool) {
+	if proxied {
+		p := newProxyConn(c, s.handshakeTimeout)
+		if err := p.init(); err != nil {
+			logs.Errorf("%v %v", p.ProxyAddr(), err)
+			return
+		}
+		c = p
+	}
+	peerAddr := c.RemoteAddr().String()
+	if !s.admit(peerAddr) {
+		c.Close()
+		return
+	}
+	switch p, proto := Sniff(c, s.handshakeTimeout); proto {
+	case "ws":
+		s.limiter.release(peerAddr)
+		s.sniffer.push(p)
+	case "wss":
+		s.limiter.release(peerAddr)
+		if s.tlsConfig == nil {
+			logs.Errorf("%v %v", c.RemoteAddr(), ErrNoCertificate)
+			p.Close()
+			return
+		}
+		//http.Server对*tls.Conn完成握手
+		s.sniffer.push(tls.Server(p, s.tlsConfig))
+	default:
+		s.connected(p, peerAddr)
+	}
+}
+
+func (s *acceptor) handshake(c net.Conn, proxied bool) {
+	if proxied {
+		p := newProxyConn(c, s.handshakeTimeout)
+		if err := p.init(); err != nil {
+			logs.Errorf("%v %v", p.ProxyAddr(), err)
+			return
+		}
+		c = p
+	}
+	if s.tlsConfig != nil {
+		p := tls.Server(c, s.tlsConfig)
+		if err := handshake(p, s.handshakeTimeout); err != nil {
+			logs.Errorf("%v %v", c.RemoteAddr(), err)
+			p.Close()
+			return
+		}
+		c = p
+	}
+	s.newConnection(c)
+}
+
+// OnCondition对端地址，TLS连接为*conn.TLSAddr
+func conditionAddr(c net.Conn) net.Addr {
+	if p, ok := c.(*tls.Conn); ok {
+		return &conn.TLSAddr{Addr: c.RemoteAddr(), State: p.ConnectionState()}
+	}
+	return c.RemoteAddr()
+}
+
+func (s *acceptor) newConnection(c net.Conn) {
+	peerAddr := c.RemoteAddr().String()
+	if !s.admit(peerAddr) {
+		c.Close()
+		return
+	}
+	s.connected(c, peerAddr)
+}
+
+// 已通过接入检查的连接
+func (s *acceptor) connected(c net.Conn, peerAddr string) {
+	switch conn.UsePool {
+	case true:
+		connpool.Do(cb.NewFunctor00(func() {
+			peerRegion := s.region(c.RemoteAddr())
+			if s.onCondition != nil && !s.onCondition(conditionAddr(c), &peerRegion) {
+				s.refuse(peerAddr, conn.ERejectCondition)
 				c.Close()
 			} else if s.onNewConnection != nil {
 				s.onNewConnection(c, s.channel, s.addr.Proto, &peerRegion)
 			} else {
+				s.limiter.release(peerAddr)
 				c.Close()
 			}
+		}))
+	default:
+		peerRegion := s.region(c.RemoteAddr())
+		if s.onCondition != nil && !s.onCondition(conditionAddr(c), &peerRegion) {
+			s.refuse(peerAddr, conn.ERejectCondition)
+			c.Close()
+		} else if s.onNewConnection != nil {
+			s.onNewConnection(c, s.channel, s.addr.Proto, &peerRegion)
+		} else {
+			s.limiter.release(peerAddr)
+			c.Close()
 		}
 	}
-	s.cleanup()
 }
 
-//	&http.Request{
-//		Method: http.MethodGet,
-//		Header: http.Header{
-//			"Upgrade":               []string{"websocket"},
-//			"Connection":            []string{"upgrade"},
-//			"Sec-Websocket-Key":     []string{"dGhlIHNhbXBsZSBub25jZQ=="},
-//			"Sec-Websocket-Version": []string{"13"},
-//		}}
-func (s acceptor) upgradeAndServe(addr *conn.Address) {
-	s.upgrader = &websocket.Upgrader{
-		HandshakeTimeout: s.handshakeTimeout,
-		ReadBufferSize:   s.readBufferSize,
-		CheckOrigin:      func(r *http.Request) bool { return true },
+// websocket升级处理，route为nil时使用缺省channel与回调
+func (s *acceptor) wsHandler(route *Route) http.HandlerFunc {
+	opt, channel, onVerify := s.wsOptions, s.wsChannel, s.onVerify
+	v := []any{}
+	if route != nil {
+		if route.Channel != nil {
+			channel = route.Channel
+		}
+		if route.OnVerify != nil {
+			onVerify = route.OnVerify
+		}
+		v = append(v, route)
 	}
-	mux := http.NewServeMux()
-	mux.HandleFunc(addr.Path, func(w http.ResponseWriter, r *http.Request) {
-		if s.onVerify != nil && !s.onVerify(w, r) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.forwarded(r)
+		if !opt.checkOrigin(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		//OnVerify中可通过Subprotocol(r)获取协商的子协议
+		r = opt.withSubprotocol(r)
+		if onVerify != nil && !onVerify(w, r) {
+			return
+		}
+		//升级前检查，拒绝时返回503
+		if reject := s.limiter.admit(r.RemoteAddr); reject.Id != conn.KNoReject {
+			s.reject(r.RemoteAddr, reject)
+			http.Error(w, reject.Msg, http.StatusServiceUnavailable)
 			return
 		}
-		c, err := s.upgrader.Upgrade(w, r, nil)
+		var header http.Header
+		if p := Subprotocol(r); p != "" {
+			header = http.Header{"Sec-Websocket-Protocol": {p}}
+		}
+		c, err := s.upgrader.Upgrade(w, r, header)
+		if err != nil {
+			s.limiter.release(r.RemoteAddr)
+			return
+		}
+		state := opt.apply(c, deflate(r.Header))
+		state.Origin = r.Header.Get("Origin")
+		peerAddr := r.RemoteAddr
+		var remoteAddr net.Addr
+		remoteAddr, err = net.ResolveTCPAddr("tcp", peerAddr)
 		if err != nil {
+			s.limiter.release(peerAddr)
+			c.Close()
 			return
 		}
+		if r.TLS != nil {
+			remoteAddr = &conn.TLSAddr{Addr: remoteAddr, State: *r.TLS}
+		}
+		proto := s.wsProto(r)
 		switch conn.UsePool {
 		case true:
 			connpool.Do(cb.NewFunctor00(func() {
-				peerRegion := conn.Region{}
-				if s.onCondition != nil && !s.onCondition(c.RemoteAddr(), &peerRegion) {
+				peerRegion := s.region(remoteAddr)
+				if s.onCondition != nil && !s.onCondition(remoteAddr, &peerRegion) {
+					s.refuse(peerAddr, conn.ERejectCondition)
 					c.Close()
 				} else if s.onNewConnection != nil {
-					s.onNewConnection(c, s.channel, s.addr.Proto, &peerRegion, w, r)
+					s.onNewConnection(c, channel, proto, &peerRegion, append([]any{w, r, state}, v...)...)
 				} else {
+					s.limiter.release(peerAddr)
 					c.Close()
 				}
 			}))
 		default:
-			peerRegion := conn.Region{}
-			if s.onCondition != nil && !s.onCondition(c.RemoteAddr(), &peerRegion) {
+			peerRegion := s.region(remoteAddr)
+			if s.onCondition != nil && !s.onCondition(remoteAddr, &peerRegion) {
+				s.refuse(peerAddr, conn.ERejectCondition)
 				c.Close()
 			} else if s.onNewConnection != nil {
-				s.onNewConnection(c, s.channel, s.addr.Proto, &peerRegion, w, r)
+				s.onNewConnection(c, channel, proto, &peerRegion, append([]any{w, r, state}, v...)...)
 			} else {
+				s.limiter.release(peerAddr)
 				c.Close()
 			}
 		}
-	})
+	}
+}
+
+// 嗅探模式按是否TLS区分ws/wss
+func (s *acceptor) wsProto(r *http.Request) string {
+	switch {
+	case s.sniffer == nil:
+		return s.addr.Proto
+	case r.TLS != nil:
+		return "wss"
+	}
+	return "ws"
+}
+
+//	&http.Request{
+//		Method: http.MethodGet,
+//		Header: http.Header{
+//			"Upgrade":               []string{"websocket"},
+//			"Connection":            []string{"upgrade"},
+//			"Sec-Websocket-Key":     []string{"dGhlIHNhbXBsZSBub25jZQ=="},
+//			"Sec-Websocket-Version": []string{"13"},
+//		}}
+func (s *acceptor) upgradeAndServe(addr *conn.Address) {
+	opt := s.wsOptions
+	s.upgrader = &websocket.Upgrader{
+		HandshakeTimeout:  s.handshakeTimeout,
+		ReadBufferSize:    s.readBufferSize,
+		EnableCompression: opt != nil && opt.Compression,
+		CheckOrigin:       opt.checkOrigin,
+	}
+	mux := http.NewServeMux()
+	paths := map[string]bool{}
+	for _, route := range s.routes {
+		mux.HandleFunc(route.Path, s.wsHandler(route))
+		paths[route.Path] = true
+	}
+	for _, h := range s.handlers {
+		mux.Handle(h.pattern, h.handler)
+		paths[h.pattern] = true
+	}
+	//未注册同名路由时监听地址路径使用缺省channel与回调
+	if !paths[addr.Path] {
+		mux.HandleFunc(addr.Path, s.wsHandler(nil))
+	}
 	s.server = &http.Server{
 		Addr:    addr.Addr,
 		Handler: mux}
@@ -292,14 +800,20 @@ func (s acceptor) upgradeAndServe(addr *conn.Address) {
 func (s *acceptor) serve() {
 	s.signal()
 	// defer s.close()
-	if s.certfile != "" && s.keyfile != "" {
-		err := s.server.ServeTLS(s.listener, s.certfile, s.keyfile)
-		if err != nil {
+	listener := s.listener
+	if s.sniffer != nil {
+		listener = s.sniffer
+	}
+	//嗅探模式由sniff区分TLS连接
+	if s.tlsConfig != nil && s.sniffer == nil {
+		s.server.TLSConfig = s.tlsConfig
+		err := s.server.ServeTLS(listener, "", "")
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logs.Errorf(err.Error())
 		}
 	} else {
-		err := s.server.Serve(s.listener)
-		if err != nil {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logs.Errorf(err.Error())
 		}
 	}
@@ -335,6 +849,8 @@ func (s *acceptor) is_stopping() bool {
 
 func (s *acceptor) stop_accept() {
 	s.stopping.Signal()
+	//关闭listener唤醒阻塞的Accept
+	s.close()
 }
 
 func (s *acceptor) stop_serve() {
@@ -351,7 +867,15 @@ func (s *acceptor) close() {
 
 func (s *acceptor) close_serve() {
 	if s.serving && s.closing[1].TestSet() {
-		s.server.Close()
+		//serve退出时会置空s.server
+		server := s.server
+		//停止接受新请求并等待处理中的http请求，websocket连接已接管由会话关闭
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Shutdown(ctx); err != nil {
+			logs.Errorf(err.Error())
+			server.Close()
+		}
+		cancel()
 		s.serving = false
 		s.closing[1].Reset()
 	}
@@ -0,0 +1,112 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+// 认证身份，期限内完成认证取消超时关闭，认证超时后返回false
+func (s *TCPConnection) Authenticate(identity *conn.Identity) bool {
+	if identity == nil {
+		return false
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.authState == conn.KAuthFailed {
+		return false
+	}
+	if s.authTimer != nil {
+		s.authTimer.Stop()
+		s.authTimer = nil
+	}
+	s.identity = identity
+	s.authState = conn.KAuthed
+	return true
+}
+
+// 认证身份，未认证为nil
+func (s *TCPConnection) Identity() (identity *conn.Identity) {
+	s.l.RLock()
+	identity = s.identity
+	s.l.RUnlock()
+	return
+}
+
+func (s *TCPConnection) AuthState() (state conn.AuthState) {
+	s.l.RLock()
+	state = s.authState
+	s.l.RUnlock()
+	return
+}
+
+// 认证期限，连接建立后d内未Authenticate关闭连接，d<=0取消
+// 连接建立前设置从建立时计时，建立后设置从当前计时
+func (s *TCPConnection) SetAuthDeadline(d time.Duration) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.authTimer != nil {
+		s.authTimer.Stop()
+		s.authTimer = nil
+	}
+	s.authD = d
+	switch s.authState {
+	case conn.KAuthNone, conn.KAuthPending:
+		if d <= 0 {
+			s.authState = conn.KAuthNone
+			return
+		}
+		s.authState = conn.KAuthPending
+		if s.state == conn.KConnected {
+			s.armAuth(d)
+		}
+	}
+}
+
+// 连接建立时开始计时
+func (s *TCPConnection) startAuth() {
+	s.l.Lock()
+	if s.authState == conn.KAuthPending && s.authD > 0 && s.authTimer == nil {
+		s.armAuth(s.authD)
+	}
+	s.l.Unlock()
+}
+
+// 须持有s.l，会话销毁后复用，按连接ID忽略旧定时器
+func (s *TCPConnection) armAuth(d time.Duration) {
+	id := s.id
+	s.authTimer = time.AfterFunc(d, func() {
+		s.authTimeout(id)
+	})
+}
+
+func (s *TCPConnection) stopAuth() {
+	s.l.Lock()
+	if s.authTimer != nil {
+		s.authTimer.Stop()
+		s.authTimer = nil
+	}
+	s.l.Unlock()
+}
+
+func (s *TCPConnection) authTimeout(id int64) {
+	s.l.Lock()
+	if s.id != id || s.authTimer == nil || s.authState != conn.KAuthPending {
+		s.l.Unlock()
+		return
+	}
+	s.authState = conn.KAuthFailed
+	s.authTimer = nil
+	s.l.Unlock()
+	s.closeUnauthenticated()
+}
+
+// 认证超时关闭对端
+func (s *TCPConnection) closeUnauthenticated() {
+	if s.conn == nil {
+		return
+	}
+	if !s.closed && s.flag.TestSet() {
+		s.notifyClose(int(conn.KAuthTimeout))
+	}
+}
@@ -0,0 +1,75 @@
+package tcp
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// 重连策略，指数退避+全抖动
+// 第n次重试间隔 min(Max, Base*Multiplier^(n-1))，Jitter时在(0, 间隔]内随机
+type ReconnectPolicy struct {
+	Base          time.Duration //初始间隔
+	Max           time.Duration //间隔上限，0不限
+	Multiplier    float64       //增长倍数，<=1时取2
+	Jitter        bool          //全抖动，避免客户端同时重连
+	MaxAttempts   int           //最大重试次数，0不限
+	Deadline      time.Duration //自首次重试起最长重试时间，0不限
+	AutoReconnect bool          //对端关闭连接(KPeerClosed)后自动重连
+}
+
+func NewReconnectPolicy(base, max time.Duration) *ReconnectPolicy {
+	return &ReconnectPolicy{
+		Base:          base,
+		Max:           max,
+		Multiplier:    2,
+		Jitter:        true,
+		AutoReconnect: true,
+	}
+}
+
+// 第attempt次重试间隔，未设置策略时为固定间隔d
+func (s *ReconnectPolicy) delay(attempt int, d time.Duration) time.Duration {
+	if s == nil {
+		return d
+	}
+	return s.Delay(attempt)
+}
+
+// 第attempt次重试间隔，Max为0时增长至不溢出为止
+func (s *ReconnectPolicy) Delay(attempt int) time.Duration {
+	m := s.Multiplier
+	if m <= 1 {
+		m = 2
+	}
+	d := s.Base
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	for i := 1; i < attempt && (s.Max <= 0 || d < s.Max); i++ {
+		if float64(d)*m > math.MaxInt64/2 {
+			break
+		}
+		d = time.Duration(float64(d) * m)
+	}
+	if s.Max > 0 && d > s.Max {
+		d = s.Max
+	}
+	if s.Jitter && d > 0 {
+		d = time.Duration(rand.Int63n(int64(d))) + 1
+	}
+	return d
+}
+
+// 放弃重试，elapsed为自首次重试起至本次重试的时长
+func (s *ReconnectPolicy) exceeded(attempt int, elapsed time.Duration) bool {
+	switch {
+	case s == nil:
+		return false
+	case s.MaxAttempts > 0 && attempt > s.MaxAttempts:
+		return true
+	case s.Deadline > 0 && elapsed > s.Deadline:
+		return true
+	}
+	return false
+}
@@ -1,10 +1,12 @@
 package tcp
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/cwloo/gonet/core/base/pool/connpool"
@@ -23,6 +25,7 @@ type Connector interface {
 	EnableRetry(bool)
 	ServerAddr() string
 	ConnectTCP(header http.Header, address ...string)
+	Dial(header http.Header, address ...string) error
 	SetProtocolCallback(cb cb.OnProtocol)
 	SetNewConnectionCallback(cb cb.OnNewConnection)
 	SetConnectErrorCallback(cb cb.OnConnectError)
@@ -30,6 +33,12 @@ type Connector interface {
 	SetIdleTimeout(d time.Duration)
 	SetDialTimeout(d time.Duration)
 	SetRetryInterval(d time.Duration)
+	SetReconnectPolicy(policy *ReconnectPolicy)
+	ReconnectPolicy() *ReconnectPolicy
+	SetRetryCallback(cb cb.OnRetry)
+	SetGiveUpCallback(cb cb.OnGiveUp)
+	SetTLSConfig(config *tls.Config)
+	SetWSOptions(opt *WSOptions)
 }
 
 type connector struct {
@@ -37,13 +46,23 @@ type connector struct {
 	retry           bool
 	header          http.Header
 	addr            *conn.Address
+	err             error
 	dialTimeout     time.Duration
+	tlsConfig       *tls.Config
+	wsOptions       *WSOptions
 	d               time.Duration
+	policy          *ReconnectPolicy
+	l               *sync.Mutex
+	attempts        int
+	first           time.Time
+	timer           *time.Timer
 	idleTimeout     time.Duration
 	channel         transmit.Channel
 	onProtocol      cb.OnProtocol
 	onNewConnection cb.OnNewConnection
 	onConnectError  cb.OnConnectError
+	onRetry         cb.OnRetry
+	onGiveUp        cb.OnGiveUp
 }
 
 func NewConnector(name string, address ...string) Connector {
@@ -51,9 +70,10 @@ func NewConnector(name string, address ...string) Connector {
 		tmp:         name,
 		dialTimeout: 10 * time.Second,
 		idleTimeout: 30 * time.Second,
-		d:           time.Second}
+		d:           time.Second,
+		l:           &sync.Mutex{}}
 	if len(address) > 0 {
-		s.addr = conn.ParseAddress(address[0])
+		s.addr, s.err = conn.ParseAddress(address[0])
 	}
 	return s
 }
@@ -70,10 +90,44 @@ func (s *connector) SetIdleTimeout(d time.Duration) {
 	s.idleTimeout = d
 }
 
+// 未设置重连策略时的固定重试间隔
 func (s *connector) SetRetryInterval(d time.Duration) {
 	s.d = d
 }
 
+// 重连策略，nil为固定间隔无限重试
+func (s *connector) SetReconnectPolicy(policy *ReconnectPolicy) {
+	s.l.Lock()
+	s.policy = policy
+	s.l.Unlock()
+}
+
+func (s *connector) ReconnectPolicy() *ReconnectPolicy {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.policy
+}
+
+// 每次重试前回调，err为上次连接错误，对端关闭后重连时为nil
+func (s *connector) SetRetryCallback(cb cb.OnRetry) {
+	s.onRetry = cb
+}
+
+// 超出重试次数或期限放弃时回调
+func (s *connector) SetGiveUpCallback(cb cb.OnGiveUp) {
+	s.onGiveUp = cb
+}
+
+// wss/tls/tcps客户端TLS配置，双向认证时设置Certificates
+func (s *connector) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+// websocket压缩/消息大小/请求的子协议
+func (s *connector) SetWSOptions(opt *WSOptions) {
+	s.wsOptions = opt
+}
+
 func (s *connector) toName() {
 	if s.name == "" {
 		s.name = s.tmp + "#" + s.addr.Format() + ".connector"
@@ -84,11 +138,24 @@ func (s *connector) Retry() bool {
 	return s.retry
 }
 
+// 禁用时取消等待中的重连
 func (s *connector) EnableRetry(retry bool) {
 	s.retry = retry
+	if !retry {
+		s.l.Lock()
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		s.attempts = 0
+		s.l.Unlock()
+	}
 }
 
 func (s *connector) ServerAddr() string {
+	if s.addr == nil {
+		return ""
+	}
 	return s.addr.Addr
 }
 
@@ -118,7 +185,16 @@ func (s *connector) assertOnNewConnection() {
 
 func (s *connector) connectTCPTimeout(addr *conn.Address, d time.Duration) error {
 	logs.Debugf("%s", addr.Format())
-	c, err := net.DialTimeout(addr.Proto, addr.Addr, d)
+	var c net.Conn
+	var err error
+	switch addr.Proto {
+	case "udp", "kcp":
+		c, err = dialUDP(addr.Addr, addr.Proto == "kcp", d)
+	case "tls", "tcps":
+		c, err = tls.DialWithDialer(&net.Dialer{Timeout: d}, "tcp", addr.Addr, clientTLSConfig(s.tlsConfig, addr.Addr))
+	default:
+		c, err = net.DialTimeout(addr.Proto, addr.Addr, d)
+	}
 	if err != nil {
 		// logs.Errorf(err.Error())
 		s.onConnectError(addr.Proto, err)
@@ -136,63 +212,122 @@ func (s *connector) connectTCPTimeout(addr *conn.Address, d time.Duration) error
 }
 
 func (s *connector) connectWSTimeout(addr *conn.Address, d time.Duration, header http.Header) error {
-	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: d}
-	u := url.URL{Scheme: addr.Proto, Host: addr.Addr, Path: addr.Path}
+	opt := s.wsOptions
+	dialer := websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: d, TLSClientConfig: s.tlsConfig}
+	if opt != nil {
+		dialer.EnableCompression = opt.Compression
+		dialer.Subprotocols = opt.Subprotocols
+	}
+	u := url.URL{Scheme: addr.Proto, Host: addr.Addr, Path: addr.Path, RawQuery: addr.Query}
 	logs.Debugf("%s", addr.Format())
-	c, _, err := dialer.Dial(u.String(), header)
+	c, rsp, err := dialer.Dial(u.String(), header)
 	if err != nil {
 		// logs.Errorf(err.Error())
 		s.onConnectError(addr.Proto, err)
 		return err
 	}
+	state := opt.apply(c, deflate(rsp.Header))
 	switch conn.UsePool {
 	case true:
 		connpool.Do(cb.NewFunctor00(func() {
-			s.onNewConnection(c, s.channel, s.addr.Proto, nil)
+			s.onNewConnection(c, s.channel, s.addr.Proto, nil, state)
 		}))
 	default:
-		s.onNewConnection(c, s.channel, s.addr.Proto, nil)
+		s.onNewConnection(c, s.channel, s.addr.Proto, nil, state)
 	}
 	return nil
 }
 
+// 首次连接，错误由日志及连接错误回调通知，启用重连时后台继续重试
 func (s *connector) ConnectTCP(header http.Header, address ...string) {
+	s.Dial(header, address...)
+}
+
+// 同ConnectTCP，地址解析或连接失败时返回错误
+func (s *connector) Dial(header http.Header, address ...string) (err error) {
 	s.assertProtocol()
 	s.assertOnNewConnection()
 	if len(address) > 0 {
-		s.addr = conn.ParseAddress(address[0])
+		//解析失败保留原地址
+		addr, err := conn.ParseAddress(address[0])
+		if err != nil {
+			logs.Errorf(err.Error())
+			return err
+		}
+		s.addr, s.err = addr, nil
+	}
+	if s.err != nil {
+		logs.Errorf(s.err.Error())
+		return s.err
 	}
 	s.header = header
 	if s.addr != nil {
 		s.toName()
 		s.channel = s.onProtocol(s.addr.Proto)
-		switch s.addr.Proto {
-		case "ws", "wss":
-			if s.connectWSTimeout(s.addr, s.dialTimeout, s.header) != nil && s.retry {
-				time.AfterFunc(s.d, s.reconnect)
-			}
-		case "tcp":
-			if s.connectTCPTimeout(s.addr, s.dialTimeout) != nil && s.retry {
-				time.AfterFunc(s.d, s.reconnect)
-			}
+		err = s.connect()
+	}
+	return
+}
+
+func (s *connector) connect() (err error) {
+	switch s.addr.Proto {
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
+		err = s.connectTCPTimeout(s.addr, s.dialTimeout)
+	case "ws", "wss":
+		err = s.connectWSTimeout(s.addr, s.dialTimeout, s.header)
+	}
+	switch err {
+	case nil:
+		s.l.Lock()
+		s.attempts = 0
+		s.l.Unlock()
+	default:
+		if s.retry {
+			s.retryLater(err)
 		}
 	}
+	return
 }
 
 func (s *connector) reconnect() {
 	// logs.Debugf("%v %v", s.name, s.addr.Addr)
-	switch s.addr.Proto {
-	case "tcp":
-		if s.connectTCPTimeout(s.addr, s.dialTimeout) != nil && s.retry {
-			time.AfterFunc(s.d, s.reconnect)
-		}
-	case "ws", "wss":
-		if s.connectWSTimeout(s.addr, s.dialTimeout, s.header) != nil && s.retry {
-			time.AfterFunc(s.d, s.reconnect)
+	s.l.Lock()
+	s.timer = nil
+	s.l.Unlock()
+	s.connect()
+}
+
+// 按重连策略延迟重连，超出次数或期限时放弃
+func (s *connector) retryLater(err error) {
+	s.l.Lock()
+	if s.timer != nil {
+		//已在等待重连
+		s.l.Unlock()
+		return
+	}
+	s.attempts++
+	now := time.Now()
+	if s.attempts == 1 {
+		s.first = now
+	}
+	attempt := s.attempts
+	delay := s.policy.delay(attempt, s.d)
+	if s.policy.exceeded(attempt, now.Add(delay).Sub(s.first)) {
+		s.attempts = 0
+		s.l.Unlock()
+		logs.Warnf("%v give up after %v attempts %v", s.name, attempt-1, err)
+		if s.onGiveUp != nil {
+			s.onGiveUp(attempt-1, err)
 		}
+		return
+	}
+	s.timer = time.AfterFunc(delay, s.reconnect)
+	s.l.Unlock()
+	if s.onRetry != nil {
+		s.onRetry(attempt, delay, err)
 	}
 }
 
 func (s *connector) Reconnect() {
-	time.AfterFunc(s.d, s.reconnect)
+	s.retryLater(nil)
 }
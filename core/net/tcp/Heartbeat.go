@@ -0,0 +1,191 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/cwloo/gonet/utils/packet"
+	"github.com/gorilla/websocket"
+)
+
+// 应用层心跳，每Interval发送一次ping，收到ping自动回复pong，收到ping/pong刷新空闲计时并记录RTT
+// ws使用ping/pong控制帧，Ping/Pong/IsPing/IsPong不生效
+// tcp按会话channel发送Ping/Pong，匹配IsPing/IsPong的消息不投递onMessage
+type Heartbeat struct {
+	Interval time.Duration
+	Ping     any
+	Pong     any
+	IsPing   func(msg any) bool
+	IsPong   func(msg any) bool
+}
+
+// ws心跳
+func NewHeartbeat(interval time.Duration) *Heartbeat {
+	return &Heartbeat{Interval: interval}
+}
+
+// tcp按packet命令心跳，配合tcpchannel.NewFrameChannel(tcpchannel.KHeadPacket, order, ...)
+func NewCmdHeartbeat(interval time.Duration, mainID, pingID, pongID uint8, order binary.ByteOrder) *Heartbeat {
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	pack := func(subID uint8) []byte {
+		msg, err := packet.NewWith(mainID, subID, packet.ENC_JSON_NONE, nil)
+		if err != nil {
+			panic(err.Error())
+		}
+		b, _ := packet.Pack(msg, order)
+		return b
+	}
+	match := func(subID uint8) func(msg any) bool {
+		cmd := uint32(packet.Enword(int(mainID), int(subID)))
+		return func(msg any) bool {
+			switch msg := msg.(type) {
+			case *packet.Msg:
+				return msg.Cmd() == cmd
+			case []byte:
+				if len(msg) < packet.HEADERSZ || msg[8] != mainID || msg[9] != subID {
+					return false
+				}
+				m, err := packet.UnpackMsg(msg, order)
+				return err == nil && m.Cmd() == cmd
+			}
+			return false
+		}
+	}
+	return &Heartbeat{
+		Interval: interval,
+		Ping:     pack(pingID),
+		Pong:     pack(pongID),
+		IsPing:   match(pingID),
+		IsPong:   match(pongID),
+	}
+}
+
+// 开始心跳，连接建立后读协程内调用
+func (s *TCPConnection) startHeartbeat() {
+	hb := s.heartbeat
+	if hb == nil {
+		return
+	}
+	if c, ok := s.conn.(*websocket.Conn); ok {
+		c.SetPingHandler(func(data string) error {
+			s.buckets.Update(s)
+			err := c.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+			if err == websocket.ErrCloseSent {
+				return nil
+			}
+			return err
+		})
+		c.SetPongHandler(func(data string) error {
+			s.buckets.Update(s)
+			if len(data) == 8 {
+				sent := int64(binary.BigEndian.Uint64([]byte(data)))
+				s.setRTT(time.Duration(time.Now().UnixNano() - sent))
+			}
+			return nil
+		})
+	}
+	if hb.Interval > 0 {
+		//会话销毁后复用，按连接ID忽略旧定时器
+		id := s.id
+		s.l.Lock()
+		s.hbTimer = time.AfterFunc(hb.Interval, func() {
+			s.ping(id)
+		})
+		s.l.Unlock()
+	}
+}
+
+func (s *TCPConnection) stopHeartbeat() {
+	s.l.Lock()
+	if s.hbTimer != nil {
+		s.hbTimer.Stop()
+		s.hbTimer = nil
+	}
+	s.l.Unlock()
+}
+
+func (s *TCPConnection) armed(id int64) (ok bool) {
+	s.l.RLock()
+	ok = s.id == id && s.hbTimer != nil
+	s.l.RUnlock()
+	return
+}
+
+func (s *TCPConnection) ping(id int64) {
+	if !s.armed(id) {
+		return
+	}
+	hb := s.heartbeat
+	if hb == nil || !s.Connected() {
+		return
+	}
+	switch c := s.conn.(type) {
+	case *websocket.Conn:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(time.Now().UnixNano()))
+		c.WriteControl(websocket.PingMessage, b[:], time.Now().Add(hb.Interval))
+	default:
+		if hb.Ping != nil {
+			s.l.Lock()
+			s.pingTime = time.Now()
+			s.l.Unlock()
+			s.writeUnbounded(hb.Ping)
+		}
+	}
+	s.l.Lock()
+	if s.id == id && s.hbTimer != nil {
+		s.hbTimer.Reset(hb.Interval)
+	}
+	s.l.Unlock()
+}
+
+// tcp心跳消息处理，返回true表示已处理
+func (s *TCPConnection) onHeartbeat(msg any) bool {
+	hb := s.heartbeat
+	switch {
+	case hb == nil:
+		return false
+	case hb.IsPing != nil && hb.IsPing(msg):
+		if hb.Pong != nil {
+			s.writeUnbounded(hb.Pong)
+		}
+		return true
+	case hb.IsPong != nil && hb.IsPong(msg):
+		s.l.Lock()
+		sent := s.pingTime
+		s.l.Unlock()
+		if !sent.IsZero() {
+			s.setRTT(time.Since(sent))
+		}
+		return true
+	}
+	return false
+}
+
+// 心跳不受高水位策略限制，避免KReject时被判为慢速对端
+func (s *TCPConnection) writeUnbounded(msg any) {
+	if s.Connected() {
+		s.mq.PushUnbounded(msg)
+	}
+}
+
+func (s *TCPConnection) setRTT(rtt time.Duration) {
+	s.l.Lock()
+	s.rtt = rtt
+	s.l.Unlock()
+}
+
+// 最近一次心跳往返时间，未测量时为0
+func (s *TCPConnection) RTT() (rtt time.Duration) {
+	s.l.RLock()
+	rtt = s.rtt
+	s.l.RUnlock()
+	return
+}
+
+// 连接建立前设置
+func (s *TCPConnection) SetHeartbeat(hb *Heartbeat) {
+	s.heartbeat = hb
+}
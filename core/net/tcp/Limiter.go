@@ -0,0 +1,125 @@
+package tcp
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/conn"
+)
+
+// 接入限制：最大连接数/单IP最大连接数/令牌桶接受速率
+type limiter struct {
+	l        *sync.Mutex
+	maxConns int
+	maxPerIP int
+	total    int
+	ips      map[string]int
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	rejected []int64
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		l:        &sync.Mutex{},
+		ips:      map[string]int{},
+		rejected: make([]int64, len(conn.Rejects)),
+	}
+}
+
+func (s *limiter) setMaxConns(n int) {
+	s.l.Lock()
+	s.maxConns = n
+	s.l.Unlock()
+}
+
+func (s *limiter) setMaxPerIP(n int) {
+	s.l.Lock()
+	s.maxPerIP = n
+	s.l.Unlock()
+}
+
+func (s *limiter) setRate(rate float64, burst int) {
+	s.l.Lock()
+	s.rate = rate
+	s.burst = float64(burst)
+	if s.burst < 1 {
+		s.burst = 1
+	}
+	s.tokens = s.burst
+	s.last = time.Now()
+	s.l.Unlock()
+}
+
+// 申请接入，通过返回ENoReject，须在连接关闭后release
+func (s *limiter) admit(peerAddr string) conn.Reject {
+	ip := hostOf(peerAddr)
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.maxConns > 0 && s.total >= s.maxConns {
+		return conn.ERejectMaxConns
+	}
+	//unix等无IP对端(未经PROXY protocol)不做单IP限制
+	if s.maxPerIP > 0 && net.ParseIP(ip) != nil && s.ips[ip] >= s.maxPerIP {
+		return conn.ERejectMaxPerIP
+	}
+	if s.rate > 0 {
+		now := time.Now()
+		s.tokens += now.Sub(s.last).Seconds() * s.rate
+		if s.tokens > s.burst {
+			s.tokens = s.burst
+		}
+		s.last = now
+		if s.tokens < 1 {
+			return conn.ERejectRate
+		}
+		s.tokens--
+	}
+	s.total++
+	s.ips[ip]++
+	return conn.ENoReject
+}
+
+func (s *limiter) release(peerAddr string) {
+	ip := hostOf(peerAddr)
+	s.l.Lock()
+	if c, ok := s.ips[ip]; ok {
+		s.total--
+		if c > 1 {
+			s.ips[ip] = c - 1
+		} else {
+			delete(s.ips, ip)
+		}
+	}
+	s.l.Unlock()
+}
+
+func (s *limiter) count(id conn.RejectID) {
+	atomic.AddInt64(&s.rejected[id], 1)
+}
+
+func (s *limiter) rejectedOf(id conn.RejectID) int64 {
+	if int(id) >= len(s.rejected) {
+		return 0
+	}
+	return atomic.LoadInt64(&s.rejected[id])
+}
+
+func (s *limiter) connections() (c int) {
+	s.l.Lock()
+	c = s.total
+	s.l.Unlock()
+	return
+}
+
+func hostOf(peerAddr string) string {
+	host, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		return peerAddr
+	}
+	return host
+}
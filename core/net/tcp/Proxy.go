@@ -0,0 +1,202 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrProxyHeader = errors.New("invalid proxy protocol header")
+	proxyV1Prefix  = []byte("PROXY ")
+	proxyV2Sig     = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	proxyV1MaxLen = 107
+	proxyTimeout  = 5 * time.Second
+)
+
+// PROXY protocol v1/v2接入的连接
+// 首次Read/RemoteAddr时解析头部，RemoteAddr为真实客户端地址
+type ProxyConn struct {
+	net.Conn
+	once   sync.Once
+	d      time.Duration
+	remote net.Addr
+	err    error
+}
+
+func newProxyConn(c net.Conn, d time.Duration) *ProxyConn {
+	if d <= 0 {
+		d = proxyTimeout
+	}
+	return &ProxyConn{Conn: c, d: d}
+}
+
+func (s *ProxyConn) init() error {
+	s.once.Do(func() {
+		s.Conn.SetReadDeadline(time.Now().Add(s.d))
+		s.remote, s.err = readProxyHeader(s.Conn)
+		s.Conn.SetReadDeadline(time.Time{})
+		if s.err != nil {
+			s.Conn.Close()
+		}
+	})
+	return s.err
+}
+
+func (s *ProxyConn) Read(b []byte) (int, error) {
+	if err := s.init(); err != nil {
+		return 0, err
+	}
+	return s.Conn.Read(b)
+}
+
+// 真实客户端地址，LOCAL/UNKNOWN时为代理地址
+func (s *ProxyConn) RemoteAddr() net.Addr {
+	if s.init() == nil && s.remote != nil {
+		return s.remote
+	}
+	return s.Conn.RemoteAddr()
+}
+
+// 代理地址
+func (s *ProxyConn) ProxyAddr() net.Addr {
+	return s.Conn.RemoteAddr()
+}
+
+// 是否携带客户端地址
+func (s *ProxyConn) Proxied() bool {
+	return s.init() == nil && s.remote != nil
+}
+
+// 解析PROXY头部，逐字节读取不越过头部
+func readProxyHeader(r io.Reader) (net.Addr, error) {
+	//v1最短15字节，v2签名12字节
+	b := make([]byte, len(proxyV2Sig), proxyV1MaxLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(b, proxyV2Sig):
+		return readProxyV2(r)
+	case bytes.HasPrefix(b, proxyV1Prefix):
+		c := []byte{0}
+		for !bytes.HasSuffix(b, []byte("\r\n")) {
+			if len(b) >= proxyV1MaxLen {
+				return nil, ErrProxyHeader
+			}
+			if _, err := io.ReadFull(r, c); err != nil {
+				return nil, err
+			}
+			b = append(b, c[0])
+		}
+		return parseProxyV1(string(b[:len(b)-2]))
+	}
+	return nil, ErrProxyHeader
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443
+func parseProxyV1(line string) (net.Addr, error) {
+	fields := strings.Split(line, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(r io.Reader) (net.Addr, error) {
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	if h[0]>>4 != 2 {
+		return nil, ErrProxyHeader
+	}
+	b := make([]byte, binary.BigEndian.Uint16(h[2:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	//LOCAL
+	if h[0]&0x0F == 0 {
+		return nil, nil
+	}
+	if h[0]&0x0F != 1 {
+		return nil, ErrProxyHeader
+	}
+	switch h[1] {
+	case 0x11: //TCP over IPv4
+		if len(b) < 12 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(b[0:4]), Port: int(binary.BigEndian.Uint16(b[8:]))}, nil
+	case 0x21: //TCP over IPv6
+		if len(b) < 36 {
+			return nil, ErrProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(b[0:16]), Port: int(binary.BigEndian.Uint16(b[32:]))}, nil
+	}
+	return nil, nil
+}
+
+// websocket监听，Accept不阻塞，头部在连接协程中解析
+type proxyListener struct {
+	net.Listener
+	s *acceptor
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.s.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	return newProxyConn(c, l.s.handshakeTimeout), nil
+}
+
+// 对端真实地址及代理地址，c/v为OnNewConnection参数
+func PeerAddr(c any, v ...any) (peerAddr, proxyAddr string) {
+	switch c := c.(type) {
+	case *ProxyConn:
+		peerAddr = c.RemoteAddr().String()
+		if c.Proxied() {
+			proxyAddr = c.ProxyAddr().String()
+		}
+	case *tls.Conn:
+		peerAddr, proxyAddr = PeerAddr(c.NetConn())
+	case *sniffConn:
+		peerAddr, proxyAddr = PeerAddr(c.Conn)
+	case net.Conn:
+		peerAddr = c.RemoteAddr().String()
+	case *websocket.Conn:
+		peerAddr, proxyAddr = PeerAddr(c.UnderlyingConn())
+		//X-Forwarded-For改写了r.RemoteAddr
+		for _, v := range v {
+			if r, ok := v.(*http.Request); ok && r.RemoteAddr != peerAddr {
+				peerAddr, proxyAddr = r.RemoteAddr, peerAddr
+			}
+		}
+	}
+	return
+}
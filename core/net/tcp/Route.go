@@ -0,0 +1,31 @@
+package tcp
+
+import (
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/transmit"
+)
+
+// websocket路由，同一端口按路径区分channel与回调，未设置的沿用服务端设置
+type Route struct {
+	Path            string
+	Channel         transmit.Channel
+	OnVerify        cb.OnVerify
+	OnConnected     cb.OnConnected
+	OnClosed        cb.OnClosed
+	OnMessage       cb.OnMessage
+	OnWriteComplete cb.OnWriteComplete
+}
+
+func NewRoute(path string, channel transmit.Channel) *Route {
+	return &Route{Path: path, Channel: channel}
+}
+
+// 会话所属路由，默认路径为nil
+func RouteOf(v ...any) *Route {
+	for _, v := range v {
+		if route, ok := v.(*Route); ok {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	sniffTimeout = 5 * time.Second
+)
+
+var (
+	httpMethods = [][]byte{
+		[]byte("GET "), []byte("POST "), []byte("HEAD "), []byte("PUT "),
+		[]byte("OPTIONS "), []byte("DELETE "), []byte("PATCH "),
+	}
+)
+
+// 嗅探过首字节的连接，已预读数据由Read返回
+type sniffConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (s *sniffConn) Read(b []byte) (int, error) {
+	return s.r.Read(b)
+}
+
+// 预读数据直到可判定协议，HTTP请求返回ws，TLS ClientHello返回wss，其余返回tcp
+// 超时仍无法判定(含服务端先发协议)按tcp处理，返回的连接可重新读取预读数据
+func Sniff(c net.Conn, d time.Duration) (net.Conn, string) {
+	if d <= 0 {
+		d = sniffTimeout
+	}
+	p := &sniffConn{Conn: c, r: bufio.NewReader(c)}
+	c.SetReadDeadline(time.Now().Add(d))
+	defer c.SetReadDeadline(time.Time{})
+	for n := 1; ; n++ {
+		b, err := p.r.Peek(n)
+		if err != nil {
+			return p, "tcp"
+		}
+		if proto, ok := detect(b); ok {
+			return p, proto
+		}
+	}
+}
+
+// 按已预读数据判定协议，数据不足时返回false
+func detect(b []byte) (string, bool) {
+	//TLS handshake record，版本0x0300-0x0304
+	if b[0] == 0x16 {
+		switch {
+		case len(b) >= 2 && b[1] != 0x03:
+			return "tcp", true
+		case len(b) < 3:
+			return "", false
+		case b[2] <= 0x04:
+			return "wss", true
+		default:
+			return "tcp", true
+		}
+	}
+	more := false
+	for _, method := range httpMethods {
+		//须匹配完整方法名及空格
+		if bytes.HasPrefix(b, method) {
+			return "ws", true
+		}
+		if bytes.HasPrefix(method, b) {
+			more = true
+		}
+	}
+	if more {
+		return "", false
+	}
+	return "tcp", true
+}
+
+// websocket部分的监听，由嗅探结果投递连接
+type sniffListener struct {
+	net.Listener
+	c    chan net.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+func newSniffListener(l net.Listener) *sniffListener {
+	return &sniffListener{Listener: l, c: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (s *sniffListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.c:
+		return c, nil
+	case <-s.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (s *sniffListener) push(c net.Conn) {
+	select {
+	case s.c <- c:
+	case <-s.done:
+		c.Close()
+	}
+}
+
+// 底层listener由accept关闭
+func (s *sniffListener) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
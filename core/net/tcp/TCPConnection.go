@@ -16,6 +16,8 @@ import (
 	"github.com/cwloo/gonet/core/net/keepalive"
 	"github.com/cwloo/gonet/core/net/transmit"
 	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/codec"
+	"github.com/cwloo/gonet/utils/packet"
 	"github.com/cwloo/gonet/utils/safe"
 	"github.com/cwloo/gonet/utils/timestamp"
 
@@ -36,21 +38,38 @@ type TCPConnection struct {
 	name              string
 	localAddr         string
 	peerAddr          string
+	proxyAddr         string
 	protoName         string
 	peerRegion        *conn.Region
 	conn              any
 	l                 sync.RWMutex
 	context           map[any]any
 	connType          conn.Type
-	mq                mq.BlockQueue
+	mq                mq.BoundedQueue
 	channel           transmit.Channel
+	codec             codec.Codec
+	batch             net.Buffers
+	batchBytes        int
+	batchCount        int
+	batchSize         int
+	complete          conn.CompleteType
 	wg                sync.WaitGroup
 	closed            bool
 	closing           cc.AtomFlag
 	flag              cc.AtomFlag
+	slow              cc.AtomFlag
 	state             conn.State
 	reason            conn.ReasonID
 	buckets           keepalive.Buckets
+	heartbeat         *Heartbeat
+	hbTimer           *time.Timer
+	pingTime          time.Time
+	rtt               time.Duration
+	wsState           *conn.WSState
+	identity          *conn.Identity
+	authState         conn.AuthState
+	authD             time.Duration
+	authTimer         *time.Timer
 	onConnected       cb.OnConnected
 	onClosed          cb.OnClosed
 	onMessage         cb.OnMessage
@@ -69,6 +88,7 @@ func NewTCPConnection(id int64, name string, c any, connType conn.Type, channel
 	peer.conn = c
 	peer.localAddr = localAddr
 	peer.peerAddr = peerAddr
+	peer.proxyAddr = ""
 	peer.peerRegion = peerRegion
 	peer.protoName = protoName
 	peer.state = conn.KDisconnected
@@ -76,11 +96,27 @@ func NewTCPConnection(id int64, name string, c any, connType conn.Type, channel
 	peer.connType = connType
 	peer.l = sync.RWMutex{}
 	peer.context = map[any]any{}
-	peer.mq = lq.NewQueue(0)
+	peer.mq = lq.NewBoundedQueue(0, mq.KBlock)
 	peer.channel = channel
+	peer.codec = nil
+	peer.batch = nil
+	peer.batchBytes = 0
+	peer.batchCount = 0
+	peer.batchSize = 0
+	peer.complete = conn.KCompletePerMsg
 	peer.closing = cc.NewAtomFlag()
 	peer.flag = cc.NewAtomFlag()
+	peer.slow = cc.NewAtomFlag()
 	peer.buckets = keepalive.NewBuckets()
+	peer.heartbeat = nil
+	peer.hbTimer = nil
+	peer.pingTime = time.Time{}
+	peer.rtt = 0
+	peer.wsState = nil
+	peer.identity = nil
+	peer.authState = conn.KAuthNone
+	peer.authD = 0
+	peer.authTimer = nil
 	return peer
 }
 
@@ -104,6 +140,39 @@ func (s *TCPConnection) setReason(reason conn.ReasonID) {
 	s.reason = reason
 }
 
+// 空闲超时，<=0不检查空闲，可在登录后修改
+func (s *TCPConnection) SetIdleTimeout(d time.Duration) {
+	s.buckets.SetTimeout(s, d)
+}
+
+func (s *TCPConnection) IdleTimeout() time.Duration {
+	return s.buckets.Timeout()
+}
+
+// websocket协商结果，非websocket为nil
+func (s *TCPConnection) WSState() *conn.WSState {
+	return s.wsState
+}
+
+// 连接建立前设置
+func (s *TCPConnection) SetWSState(state *conn.WSState) {
+	s.wsState = state
+}
+
+// 压缩消息读限制按帧大小计算，解压后再检查
+func (s *TCPConnection) overLimit(msg any) bool {
+	if s.wsState == nil || !s.wsState.Compression || s.wsState.ReadLimit <= 0 {
+		return false
+	}
+	b, ok := msg.([]byte)
+	return ok && int64(len(b)) > s.wsState.ReadLimit
+}
+
+// 关闭原因
+func (s *TCPConnection) Reason() conn.Reason {
+	return conn.Reasons[s.reason]
+}
+
 func (s *TCPConnection) Connected() bool {
 	return s.state == conn.KConnected
 }
@@ -145,6 +214,15 @@ func (s *TCPConnection) RemoteAddr() string {
 	return s.peerAddr
 }
 
+// 经代理接入时的代理地址，RemoteAddr为真实客户端地址
+func (s *TCPConnection) ProxyAddr() string {
+	return s.proxyAddr
+}
+
+func (s *TCPConnection) SetProxyAddr(proxyAddr string) {
+	s.proxyAddr = proxyAddr
+}
+
 func (s *TCPConnection) RemoteRegion() conn.Region {
 	switch s.peerRegion {
 	case nil:
@@ -201,6 +279,46 @@ func (s *TCPConnection) GetContextLocker(key any) (val any) {
 	return
 }
 
+// 设置会话编解码器，非[]byte/string消息发送前按该编解码器编码
+func (s *TCPConnection) SetCodec(name string) bool {
+	c := codec.Get(name)
+	if c == nil {
+		return false
+	}
+	s.codec = c
+	return true
+}
+
+func (s *TCPConnection) Codec() codec.Codec {
+	return s.codec
+}
+
+func (s *TCPConnection) encode(msg any) (any, error) {
+	switch msg.(type) {
+	case string, []byte, *packet.Msg:
+		return msg, nil
+	default:
+		switch s.codec {
+		case nil:
+			return msg, nil
+		default:
+			return s.codec.Marshal(msg)
+		}
+	}
+}
+
+// 设置发送队列高水位及队列满处理策略，size<=0不限制
+// mq.KBlock 队列满时阻塞写入方直到有空位，无超时，对端不读时写入方一直阻塞
+// mq.KReject 队列满时以KSlowConsumer关闭慢速对端
+func (s *TCPConnection) SetHighWaterMark(size int, policy mq.Policy) {
+	s.mq.SetLimit(size, policy)
+}
+
+// 发送队列深度
+func (s *TCPConnection) QueueSize() int {
+	return s.mq.Size()
+}
+
 func (s *TCPConnection) SetConnectedCallback(cb cb.OnConnected) {
 	s.onConnected = cb
 }
@@ -251,6 +369,8 @@ func (s *TCPConnection) connectEstablished(v ...any) {
 	s.closed = false
 	s.setState(conn.KConnected)
 	s.buckets.Push(s)
+	s.startHeartbeat()
+	s.startAuth()
 	if s.onConnected != nil {
 		s.onConnected(s, v...)
 	}
@@ -264,6 +384,8 @@ func (s *TCPConnection) ConnectDestroyed() {
 		logs.Fatalf("error")
 	}
 	s.setState(conn.KDisconnected)
+	s.stopHeartbeat()
+	s.stopAuth()
 	s.buckets.Put()
 	if s.onClosed != nil {
 		s.onClosed(s, conn.Reasons[s.reason])
@@ -291,6 +413,9 @@ LOOP:
 		}
 		i++
 		msgType, msg, err := s.channel.OnRecv(s.conn)
+		if err == nil && s.overLimit(msg) {
+			err = websocket.ErrReadLimit
+		}
 		if err != nil {
 			// logs.Errorf("%v", err)
 			// if !IsEOFOrReadError(err) {
@@ -308,6 +433,10 @@ LOOP:
 			case conn.KSelfClosedDelay:
 				// logs.Infof("self closed connection delay.")
 				break LOOP
+			case conn.KSlowConsumer:
+				break LOOP
+			case conn.KAuthTimeout:
+				break LOOP
 			default:
 				// logs.Infof("peer closed connection.")
 				s.setReason(conn.KPeerClosed)
@@ -319,6 +448,8 @@ LOOP:
 			}
 		} else if msg == nil {
 			logs.Fatalf("error")
+		} else if s.onHeartbeat(msg) {
+			s.buckets.Update(s)
 		} else if s.onMessage != nil {
 			s.buckets.Update(s)
 			s.onMessage(s, msg, msgType, timestamp.Now())
@@ -364,34 +495,18 @@ LOOP:
 			// if ctx := s.GetContext("ctx").(user_context.Ctx); ctx != nil {
 			// 	logs.Debugf("[%v:%v] write =>", ctx.GetUserId(), ctx.GetSession())
 			// }
+			if s.slow.IsSet() {
+				return
+			}
 			switch msg := msg.(type) {
 			case transmit.Messagetruct:
-				err := s.channel.OnSend(s.conn, msg.Msg, msg.Type)
-				if err != nil {
-					logs.Errorf("%v", err)
-					// if !transmit.IsEOFOrWriteError(err) {
-					// 	if s.errorCallback != nil {
-					// 		s.errorCallback(err)
-					// 	}
-					// }
-				} else if s.onWriteComplete != nil {
-					s.onWriteComplete(s)
-				}
+				s.send(msg.Msg, msg.Type)
 			default:
-				err := s.channel.OnSend(s.conn, msg, websocket.BinaryMessage)
-				if err != nil {
-					logs.Errorf("%v", err)
-					// if !transmit.IsEOFOrWriteError(err) {
-					// 	if s.errorCallback != nil {
-					// 		s.errorCallback(err)
-					// 	}
-					// }
-				} else if s.onWriteComplete != nil {
-					s.onWriteComplete(s)
-				}
+				s.send(msg, websocket.BinaryMessage)
 			}
 			return
 		})
+		s.flushBatch()
 		if exit {
 			if s.reason == conn.KPeerClosed {
 				// logs.Infof("peer closed connection.")
@@ -406,6 +521,10 @@ LOOP:
 				case int(conn.KSelfClosedDelay):
 					// logs.Infof("self closed connection delay.")
 					s.setReason(conn.KSelfClosedDelay)
+				case int(conn.KSlowConsumer):
+					s.setReason(conn.KSlowConsumer)
+				case int(conn.KAuthTimeout):
+					s.setReason(conn.KAuthTimeout)
 				default:
 					logs.Fatalf("error")
 				}
@@ -414,21 +533,109 @@ LOOP:
 		}
 		// }
 	}
+	s.mq.Release()
 	s.close()
 	// logs.Infof("exit.")
 	s.wg.Done()
 }
 
+// 发送单条消息，开启合并写时先编码放入批次
+func (s *TCPConnection) send(msg any, msgType int) {
+	b, err := s.encode(msg)
+	if err == nil {
+		if s.batchCount > 0 {
+			if enc, ok := s.channel.(transmit.Encoder); ok {
+				if _, ok := s.conn.(net.Conn); ok {
+					s.appendBatch(enc, b, msgType)
+					return
+				}
+			}
+		}
+		err = s.channel.OnSend(s.conn, b, msgType)
+	}
+	if err != nil {
+		logs.Errorf("%v", err)
+		// if !transmit.IsEOFOrWriteError(err) {
+		// 	if s.errorCallback != nil {
+		// 		s.errorCallback(err)
+		// 	}
+		// }
+	} else if s.onWriteComplete != nil {
+		s.onWriteComplete(s)
+	}
+}
+
+// 放入批次，超过条数/字节数上限立即发送
+func (s *TCPConnection) appendBatch(enc transmit.Encoder, msg any, msgType int) {
+	b, err := enc.OnEncode(msg, msgType)
+	if err != nil {
+		logs.Errorf("%v", err)
+		return
+	}
+	if len(b) == 0 {
+		return
+	}
+	s.batch = append(s.batch, b)
+	s.batchBytes += len(b)
+	if len(s.batch) >= s.batchCount || (s.batchSize > 0 && s.batchBytes >= s.batchSize) {
+		s.flushBatch()
+	}
+}
+
+// 批量发送(writev)
+func (s *TCPConnection) flushBatch() {
+	n := len(s.batch)
+	if n == 0 {
+		return
+	}
+	bufs := s.batch
+	_, err := bufs.WriteTo(s.conn.(net.Conn))
+	for i := range s.batch {
+		s.batch[i] = nil
+	}
+	s.batch = s.batch[:0]
+	s.batchBytes = 0
+	if err != nil {
+		logs.Errorf("%v", err)
+		return
+	}
+	if s.onWriteComplete != nil {
+		switch s.complete {
+		case conn.KCompletePerBatch:
+			s.onWriteComplete(s)
+		default:
+			for i := 0; i < n; i++ {
+				s.onWriteComplete(s)
+			}
+		}
+	}
+}
+
+// 设置合并写(仅tcp流协议且channel实现transmit.Encoder)
+// count 单批次最大条数，<=0关闭合并写
+// size 单批次最大字节数，<=0不限制
+func (s *TCPConnection) SetWriteBatch(count, size int, complete conn.CompleteType) {
+	s.batchCount = count
+	s.batchSize = size
+	s.complete = complete
+}
+
 // 写数据
 func (s *TCPConnection) Write(msg any) {
+	s.WriteWithResult(msg)
+}
+
+// 写数据，返回是否入队
+func (s *TCPConnection) WriteWithResult(msg any) bool {
 	switch msg {
 	case nil:
 	default:
 		switch s.Connected() {
 		case true:
-			s.mq.Push(msg)
+			return s.push(msg)
 		}
 	}
+	return false
 }
 
 func (s *TCPConnection) WriteText(msg any) {
@@ -439,16 +646,38 @@ func (s *TCPConnection) WriteText(msg any) {
 		case true:
 			switch msg := msg.(type) {
 			case []byte:
-				s.mq.Push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: msg})
+				s.push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: msg})
 			case string:
-				s.mq.Push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: []byte(msg)})
+				s.push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: []byte(msg)})
 			default:
-				s.mq.Push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: msg})
+				s.push(transmit.Messagetruct{Type: websocket.TextMessage, Msg: msg})
 			}
 		}
 	}
 }
 
+func (s *TCPConnection) push(msg any) bool {
+	if s.mq.TryPush(msg) {
+		return true
+	}
+	if _, policy := s.mq.Limit(); policy == mq.KReject {
+		s.closeSlowConsumer()
+	}
+	return false
+}
+
+// 发送队列满关闭慢速对端，丢弃未发送数据
+func (s *TCPConnection) closeSlowConsumer() {
+	if s.conn == nil {
+		return
+	}
+	if !s.closed && s.flag.TestSet() {
+		//关闭原因由写协程设置，这里只标记丢弃未发送数据
+		s.slow.Set()
+		s.notifyClose(int(conn.KSlowConsumer))
+	}
+}
+
 // 关闭连接
 func (s *TCPConnection) Close() {
 	if s.conn == nil {
@@ -459,6 +688,23 @@ func (s *TCPConnection) Close() {
 	}
 }
 
+// 立即关闭连接，丢弃未发送数据
+func (s *TCPConnection) ForceClose() {
+	if s.conn == nil {
+		return
+	}
+	if !s.closed {
+		if s.reason == conn.KNoError {
+			s.setReason(conn.KSelfClosed)
+		}
+		if s.flag.TestSet() {
+			s.notifyClose(int(conn.KSelfClosed))
+		}
+		//唤醒阻塞的读写
+		s.close()
+	}
+}
+
 // 过期关闭对端
 func (s *TCPConnection) CloseExpired() {
 	if s.conn == nil {
@@ -492,6 +738,10 @@ func (s *TCPConnection) notifyClose(flag int) {
 		s.mq.Push(&mq.ExitStruct{Code: int(conn.KSelfClosedExpired)})
 	case int(conn.KSelfClosed):
 		s.mq.Push(&mq.ExitStruct{Code: int(conn.KSelfClosed)})
+	case int(conn.KSlowConsumer):
+		s.mq.Push(&mq.ExitStruct{Code: int(conn.KSlowConsumer)})
+	case int(conn.KAuthTimeout):
+		s.mq.Push(&mq.ExitStruct{Code: int(conn.KAuthTimeout)})
 	default:
 		logs.Fatalf("error")
 	}
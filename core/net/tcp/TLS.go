@@ -0,0 +1,120 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	logs "github.com/cwloo/gonet/logs"
+)
+
+var (
+	ErrNoCertificate = errors.New("tls certificate not set")
+	ErrClientCA      = errors.New("tls invalid client ca")
+)
+
+// 证书，文件修改后自动重新加载
+type certificate struct {
+	certfile, keyfile string
+	l                 *sync.RWMutex
+	cert              *tls.Certificate
+	modTime           time.Time
+	checked           time.Time
+}
+
+func newCertificate(certfile, keyfile string) (*certificate, error) {
+	s := &certificate{certfile: certfile, keyfile: keyfile, l: &sync.RWMutex{}}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *certificate) modified() (t time.Time) {
+	for _, file := range []string{s.certfile, s.keyfile} {
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(t) {
+			t = fi.ModTime()
+		}
+	}
+	return
+}
+
+func (s *certificate) load() error {
+	modTime := s.modified()
+	cert, err := tls.LoadX509KeyPair(s.certfile, s.keyfile)
+	if err != nil {
+		return err
+	}
+	s.l.Lock()
+	s.cert = &cert
+	s.modTime = modTime
+	s.checked = time.Now()
+	s.l.Unlock()
+	return nil
+}
+
+// tls.Config.GetCertificate，每秒最多检查一次文件修改时间
+func (s *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.l.RLock()
+	cert, modTime, checked := s.cert, s.modTime, s.checked
+	s.l.RUnlock()
+	if time.Since(checked) < time.Second {
+		return cert, nil
+	}
+	s.l.Lock()
+	s.checked = time.Now()
+	s.l.Unlock()
+	if s.modified().After(modTime) {
+		if err := s.load(); err != nil {
+			//证书可能正在写入，保留旧证书
+			logs.Errorf("%v %v", s.certfile, err)
+		} else {
+			logs.Infof("%v reloaded", s.certfile)
+			s.l.RLock()
+			cert = s.cert
+			s.l.RUnlock()
+		}
+	}
+	return cert, nil
+}
+
+// 加载CA证书
+func loadCertPool(cafile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(cafile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, ErrClientCA
+	}
+	return pool, nil
+}
+
+// TLS握手，d<=0不限时
+func handshake(c *tls.Conn, d time.Duration) error {
+	if d > 0 {
+		c.SetDeadline(time.Now().Add(d))
+		defer c.SetDeadline(time.Time{})
+	}
+	return c.Handshake()
+}
+
+// 客户端TLS配置，未指定ServerName时取连接地址
+func clientTLSConfig(config *tls.Config, addr string) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	} else if config.ServerName != "" {
+		return config
+	} else {
+		config = config.Clone()
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		config.ServerName = host
+	}
+	return config
+}
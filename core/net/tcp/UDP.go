@@ -0,0 +1,485 @@
+package tcp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	udpData        byte = 0x01 //不可靠数据
+	udpFin         byte = 0x02 //关闭
+	udpSyn         byte = 0x03 //建立会话请求，携带cookie时建立
+	udpCookie      byte = 0x04 //服务端下发cookie
+	udpSynAck      byte = 0x05 //会话已建立
+	udpMTU              = 1400
+	udpMaxData          = 65507 - 1
+	udpBacklog          = 128
+	udpQueue            = 1024            //不可靠模式接收队列(数据报数)，满时丢弃
+	udpBuffer           = 4 << 20         //socket收发缓冲
+	udpLinger           = 2 * time.Second //关闭时等待确认，无进展超过该时长放弃
+	udpCookieLen        = 8
+	udpSynLen           = 64 //首个syn填充长度，不小于cookie应答，避免伪造源地址放大
+	udpCookieLife       = 30 * time.Second
+	udpSynRetry         = 200 * time.Millisecond
+	udpDialTimeout      = 10 * time.Second
+)
+
+var (
+	ErrUDPTooLarge  = errors.New("udp datagram too large")
+	ErrUDPHandshake = errors.New("udp handshake timeout")
+)
+
+// UDP虚拟连接，实现net.Conn，可直接用于TCPConnection
+// udp:// 每次Write一个数据报，不保证到达及顺序，帧须完整写入单个数据报
+// kcp:// 经ARQ层提供可靠有序字节流
+type udpConn struct {
+	l       *sync.Mutex
+	cond    *sync.Cond
+	rbuf    bytes.Buffer
+	queue   [][]byte
+	closed  bool
+	eof     bool
+	local   net.Addr
+	remote  net.Addr
+	output  func(b []byte) error
+	onClose func()
+	arq     *arq
+}
+
+func newUDPConn(local, remote net.Addr, reliable bool, output func(b []byte) error, onClose func()) *udpConn {
+	s := &udpConn{
+		l:       &sync.Mutex{},
+		local:   local,
+		remote:  remote,
+		output:  output,
+		onClose: onClose,
+	}
+	s.cond = sync.NewCond(s.l)
+	if reliable {
+		s.arq = newARQ(s)
+	}
+	return s
+}
+
+// 收到数据报
+func (s *udpConn) input(pkt []byte) {
+	if len(pkt) == 0 {
+		return
+	}
+	switch pkt[0] {
+	case udpData:
+		s.deliver(pkt[1:])
+	case udpFin:
+		s.shutdown()
+	case udpSyn:
+		//确认丢失，对端重发
+		s.output([]byte{udpSynAck})
+	case udpCookie, udpSynAck:
+	default:
+		if s.arq != nil {
+			s.arq.input(pkt)
+		}
+	}
+}
+
+// 数据交付读缓冲
+// 可靠模式为有序字节流，不可靠模式按数据报入队，队列满丢弃
+func (s *udpConn) deliver(b []byte) {
+	s.l.Lock()
+	if !s.closed {
+		switch {
+		case s.arq != nil:
+			s.rbuf.Write(b)
+		case len(s.queue) < udpQueue:
+			s.queue = append(s.queue, b)
+		}
+		s.cond.Broadcast()
+	}
+	s.l.Unlock()
+}
+
+// 读缓冲字节数
+func (s *udpConn) buffered() (n int) {
+	s.l.Lock()
+	n = s.rbuf.Len()
+	s.l.Unlock()
+	return
+}
+
+// 对端关闭，读完缓冲后返回io.EOF
+func (s *udpConn) shutdown() {
+	s.l.Lock()
+	s.eof = true
+	s.cond.Broadcast()
+	s.l.Unlock()
+}
+
+// 不可靠模式每次最多返回一个数据报，b不足时剩余部分下次返回
+func (s *udpConn) Read(b []byte) (n int, err error) {
+	s.l.Lock()
+	for s.rbuf.Len() == 0 && len(s.queue) == 0 && !s.closed && !s.eof {
+		s.cond.Wait()
+	}
+	switch {
+	case s.rbuf.Len() > 0:
+		n, err = s.rbuf.Read(b)
+	case len(s.queue) > 0:
+		n = copy(b, s.queue[0])
+		if n < len(s.queue[0]) {
+			s.queue[0] = s.queue[0][n:]
+		} else {
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+		}
+	case s.closed:
+		err = net.ErrClosed
+	default:
+		err = io.EOF
+	}
+	s.l.Unlock()
+	return
+}
+
+func (s *udpConn) Write(b []byte) (int, error) {
+	s.l.Lock()
+	closed := s.closed || s.eof
+	s.l.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+	if s.arq != nil {
+		if err := s.arq.send(b); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if len(b) > udpMaxData {
+		return 0, ErrUDPTooLarge
+	}
+	pkt := make([]byte, 1+len(b))
+	pkt[0] = udpData
+	copy(pkt[1:], b)
+	if err := s.output(pkt); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// 可靠模式FIN随数据可靠有序发送，等待确认后释放
+func (s *udpConn) Close() error {
+	s.l.Lock()
+	if s.closed {
+		s.l.Unlock()
+		return net.ErrClosed
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.l.Unlock()
+	if s.arq != nil {
+		go func() {
+			s.arq.close()
+			s.arq.linger(udpLinger)
+			s.arq.stop()
+			s.release()
+		}()
+		return nil
+	}
+	s.output([]byte{udpFin})
+	s.release()
+	return nil
+}
+
+func (s *udpConn) release() {
+	if s.onClose != nil {
+		s.onClose()
+	}
+}
+
+func (s *udpConn) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *udpConn) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// 不支持超时设置
+func (s *udpConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *udpConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// UDP监听，按对端地址分发数据报，实现net.Listener
+// 对端须先完成cookie握手才建立会话，伪造源地址无法创建会话
+// Close后停止接受新会话，已有会话全部关闭后释放socket
+type udpListener struct {
+	l        *sync.Mutex
+	pc       net.PacketConn
+	reliable bool
+	secret   []byte
+	conns    map[string]*udpConn
+	accept   chan *udpConn
+	closed   bool
+	closeCh  chan struct{}
+}
+
+func listenUDP(address string, reliable bool) (net.Listener, error) {
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if uc, ok := pc.(*net.UDPConn); ok {
+		uc.SetReadBuffer(udpBuffer)
+		uc.SetWriteBuffer(udpBuffer)
+	}
+	return ListenPacket(pc, reliable), nil
+}
+
+// 基于已有PacketConn监听(自定义传输)，reliable为kcp模式
+func ListenPacket(pc net.PacketConn, reliable bool) net.Listener {
+	s := &udpListener{
+		l:        &sync.Mutex{},
+		pc:       pc,
+		reliable: reliable,
+		secret:   make([]byte, 16),
+		conns:    map[string]*udpConn{},
+		accept:   make(chan *udpConn, udpBacklog),
+		closeCh:  make(chan struct{}),
+	}
+	rand.Read(s.secret)
+	go s.readLoop()
+	return s
+}
+
+func (s *udpListener) readLoop() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		pkt := append([]byte{}, buf[:n]...)
+		key := addr.String()
+		s.l.Lock()
+		c, ok := s.conns[key]
+		s.l.Unlock()
+		if !ok {
+			s.handshake(pkt, addr)
+			continue
+		}
+		c.input(pkt)
+	}
+}
+
+// 无状态握手，syn(填充至udpSynLen) -> cookie -> syn+cookie -> synack
+// 未填充的syn丢弃，应答不大于请求
+func (s *udpListener) handshake(pkt []byte, addr net.Addr) {
+	if pkt[0] != udpSyn {
+		return
+	}
+	switch {
+	case len(pkt) >= udpSynLen:
+		s.pc.WriteTo(append([]byte{udpCookie}, s.cookie(addr, 0)...), addr)
+	case len(pkt) == 1+udpCookieLen:
+		if !s.verify(pkt[1:], addr) {
+			return
+		}
+		key := addr.String()
+		s.l.Lock()
+		if _, ok := s.conns[key]; ok || s.closed {
+			s.l.Unlock()
+			return
+		}
+		c := newUDPConn(s.pc.LocalAddr(), addr, s.reliable, func(b []byte) error {
+			_, err := s.pc.WriteTo(b, addr)
+			return err
+		}, func() {
+			s.remove(key)
+		})
+		select {
+		case s.accept <- c:
+			s.conns[key] = c
+			s.l.Unlock()
+			c.output([]byte{udpSynAck})
+		default:
+			//backlog满，对端超时重试
+			s.l.Unlock()
+			if c.arq != nil {
+				c.arq.stop()
+			}
+		}
+	}
+}
+
+// cookie = HMAC(secret, addr, 时间片)
+func (s *udpListener) cookie(addr net.Addr, epoch int64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(time.Now().Unix()/int64(udpCookieLife/time.Second)-epoch))
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(addr.String()))
+	h.Write(b[:])
+	return h.Sum(nil)[:udpCookieLen]
+}
+
+// 当前及上一时间片有效
+func (s *udpListener) verify(cookie []byte, addr net.Addr) bool {
+	return hmac.Equal(cookie, s.cookie(addr, 0)) || hmac.Equal(cookie, s.cookie(addr, 1))
+}
+
+func (s *udpListener) remove(key string) {
+	s.l.Lock()
+	delete(s.conns, key)
+	release := s.closed && len(s.conns) == 0
+	s.l.Unlock()
+	if release {
+		s.pc.Close()
+	}
+}
+
+func (s *udpListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.accept:
+		return c, nil
+	case <-s.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+func (s *udpListener) Close() error {
+	s.l.Lock()
+	if s.closed {
+		s.l.Unlock()
+		return net.ErrClosed
+	}
+	s.closed = true
+	close(s.closeCh)
+	release := len(s.conns) == 0
+	s.l.Unlock()
+	if release {
+		s.pc.Close()
+	}
+	return nil
+}
+
+func (s *udpListener) Addr() net.Addr {
+	return s.pc.LocalAddr()
+}
+
+// UDP客户端连接，d为握手超时
+func dialUDP(address string, reliable bool, d time.Duration) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	uc, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	uc.SetReadBuffer(udpBuffer)
+	uc.SetWriteBuffer(udpBuffer)
+	return dialPacket(uc, uc.RemoteAddr(), reliable, d, func(b []byte) error {
+		_, err := uc.Write(b)
+		return err
+	})
+}
+
+// 基于已有PacketConn连接raddr(自定义传输)，d为握手超时，连接关闭时关闭pc
+func DialPacket(pc net.PacketConn, raddr net.Addr, reliable bool, d time.Duration) (net.Conn, error) {
+	return dialPacket(pc, raddr, reliable, d, func(b []byte) error {
+		_, err := pc.WriteTo(b, raddr)
+		return err
+	})
+}
+
+func dialPacket(pc net.PacketConn, raddr net.Addr, reliable bool, d time.Duration, output func(b []byte) error) (net.Conn, error) {
+	if d <= 0 {
+		d = udpDialTimeout
+	}
+	c := newUDPConn(pc.LocalAddr(), raddr, reliable, output, func() {
+		pc.Close()
+	})
+	cookies := make(chan []byte, 1)
+	established := make(chan struct{})
+	once := sync.Once{}
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					break
+				}
+				//对端不可达，握手阶段由超时处理
+				select {
+				case <-established:
+					c.shutdown()
+				default:
+				}
+				continue
+			}
+			if n == 0 || addr.String() != raddr.String() {
+				continue
+			}
+			switch buf[0] {
+			case udpCookie:
+				if n == 1+udpCookieLen {
+					select {
+					case cookies <- append([]byte{}, buf[1:n]...):
+					default:
+					}
+				}
+				continue
+			}
+			//synack丢失时首个数据包同样表示已建立
+			once.Do(func() {
+				close(established)
+			})
+			c.input(append([]byte{}, buf[:n]...))
+		}
+	}()
+	syn := make([]byte, udpSynLen)
+	syn[0] = udpSyn
+	output(syn)
+	ticker := time.NewTicker(udpSynRetry)
+	defer ticker.Stop()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case cookie := <-cookies:
+			syn = append([]byte{udpSyn}, cookie...)
+			output(syn)
+		case <-ticker.C:
+			output(syn)
+		case <-established:
+			return c, nil
+		case <-timer.C:
+			if c.arq != nil {
+				c.arq.stop()
+			}
+			pc.Close()
+			return nil, ErrUDPHandshake
+		}
+	}
+}
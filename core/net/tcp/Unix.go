@@ -0,0 +1,42 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotSocket  = errors.New("unix socket path is not a socket")
+	ErrSocketUsed = errors.New("unix socket in use")
+)
+
+// 抽象命名空间(linux)，不对应文件
+func isAbstract(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// 清理残留socket文件，文件存在且无进程监听时删除
+func removeStaleSocket(path string) error {
+	if isAbstract(path) {
+		return nil
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return ErrNotSocket
+	}
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		c.Close()
+		return ErrSocketUsed
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,133 @@
+package tcp
+
+import (
+	"compress/flate"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/gorilla/websocket"
+)
+
+// websocket选项，服务端/客户端通用
+type WSOptions struct {
+	Compression      bool     //协商permessage-deflate
+	CompressionLevel int      //压缩级别[-2,9]，0为缺省级别
+	ReadLimit        int64    //单条消息最大字节数，超出关闭连接，<=0不限制
+	Origins          []string //服务端允许的Origin，空为全部允许，支持"*"/"*.example.com"/"example.com"/"https://example.com"
+	Subprotocols     []string //服务端支持/客户端请求的子协议，按优先级排列
+}
+
+func NewWSOptions() *WSOptions {
+	return &WSOptions{}
+}
+
+type subprotocolKey struct{}
+
+// OnVerify中获取协商的子协议，未协商为空
+func Subprotocol(r *http.Request) string {
+	if p, ok := r.Context().Value(subprotocolKey{}).(string); ok {
+		return p
+	}
+	return ""
+}
+
+// 会话websocket协商结果，非websocket为nil
+func WSStateOf(v ...any) *conn.WSState {
+	for _, v := range v {
+		if state, ok := v.(*conn.WSState); ok {
+			return state
+		}
+	}
+	return nil
+}
+
+// 检查Origin，无Origin(非浏览器)放行
+func (s *WSOptions) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if s == nil || len(s.Origins) == 0 || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range s.Origins {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*":
+			return true
+		case strings.Contains(allowed, "://"):
+			if strings.EqualFold(origin, allowed) {
+				return true
+			}
+		case strings.HasPrefix(allowed, "*."):
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		case host == allowed:
+			return true
+		}
+	}
+	return false
+}
+
+// 按服务端优先级选择客户端请求的子协议
+func (s *WSOptions) subprotocol(r *http.Request) string {
+	if s == nil {
+		return ""
+	}
+	offered := websocket.Subprotocols(r)
+	for _, p := range s.Subprotocols {
+		for _, o := range offered {
+			if o == p {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func (s *WSOptions) withSubprotocol(r *http.Request) *http.Request {
+	if p := s.subprotocol(r); p != "" {
+		return r.WithContext(context.WithValue(r.Context(), subprotocolKey{}, p))
+	}
+	return r
+}
+
+// 握手完成后应用到连接
+func (s *WSOptions) apply(c *websocket.Conn, compression bool) *conn.WSState {
+	state := &conn.WSState{Subprotocol: c.Subprotocol()}
+	if s == nil {
+		return state
+	}
+	if compression && s.Compression {
+		state.Compression = true
+		c.EnableWriteCompression(true)
+		if s.CompressionLevel != 0 {
+			if err := c.SetCompressionLevel(s.CompressionLevel); err != nil {
+				c.SetCompressionLevel(flate.DefaultCompression)
+			}
+		}
+	}
+	if s.ReadLimit > 0 {
+		state.ReadLimit = s.ReadLimit
+		c.SetReadLimit(s.ReadLimit)
+	}
+	return state
+}
+
+// 对端是否同意permessage-deflate
+func deflate(header http.Header) bool {
+	for _, ext := range header.Values("Sec-Websocket-Extensions") {
+		for _, ext := range strings.Split(ext, ",") {
+			if strings.HasPrefix(strings.TrimSpace(ext), "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,385 @@
+package tcp_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/tcp"
+)
+
+type memAddr string
+
+func (s memAddr) Network() string {
+	return "mem"
+}
+
+func (s memAddr) String() string {
+	return string(s)
+}
+
+type datagram struct {
+	b    []byte
+	from net.Addr
+}
+
+// 内存PacketConn，按概率丢包/乱序
+type memConn struct {
+	addr    memAddr
+	peer    *memConn
+	in      chan datagram
+	loss    float64
+	reorder float64
+	l       sync.Mutex
+	rnd     *rand.Rand
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newMemPair(loss, reorder float64) (*memConn, *memConn) {
+	a := newMemConn("server", loss, reorder, 1)
+	b := newMemConn("client", loss, reorder, 2)
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func newMemConn(addr string, loss, reorder float64, seed int64) *memConn {
+	return &memConn{
+		addr:    memAddr(addr),
+		in:      make(chan datagram, 4096),
+		loss:    loss,
+		reorder: reorder,
+		rnd:     rand.New(rand.NewSource(seed)),
+		done:    make(chan struct{}),
+	}
+}
+
+func (s *memConn) roll() float64 {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.rnd.Float64()
+}
+
+func (s *memConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-s.done:
+		return 0, net.ErrClosed
+	default:
+	}
+	if s.roll() < s.loss {
+		return len(b), nil
+	}
+	d := datagram{b: append([]byte{}, b...), from: s.addr}
+	if s.roll() < s.reorder {
+		time.AfterFunc(time.Duration(s.roll()*float64(20*time.Millisecond)), func() {
+			s.peer.push(d)
+		})
+		return len(b), nil
+	}
+	s.peer.push(d)
+	return len(b), nil
+}
+
+func (s *memConn) push(d datagram) {
+	select {
+	case s.in <- d:
+	default:
+	}
+}
+
+func (s *memConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case d := <-s.in:
+		return copy(b, d.b), d.from, nil
+	case <-s.done:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (s *memConn) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+func (s *memConn) LocalAddr() net.Addr {
+	return s.addr
+}
+
+func (s *memConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *memConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *memConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func accept(t *testing.T, l net.Listener, d time.Duration) net.Conn {
+	ch := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			ch <- c
+		}
+	}()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(d):
+		return nil
+	}
+}
+
+func TestKCPLossReorder(t *testing.T) {
+	a, b := newMemPair(0.2, 0.3)
+	l := tcp.ListenPacket(a, true)
+	defer l.Close()
+	c, err := tcp.DialPacket(b, a.LocalAddr(), true, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := accept(t, l, 5*time.Second)
+	if s == nil {
+		t.Fatal("accept timeout")
+	}
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(3)).Read(data)
+	go func() {
+		for b := data; len(b) > 0; {
+			n := 1000
+			if n > len(b) {
+				n = len(b)
+			}
+			if _, err := c.Write(b[:n]); err != nil {
+				return
+			}
+			b = b[n:]
+		}
+		//FIN排在数据之后
+		c.Close()
+	}()
+	done := make(chan error, 1)
+	got := make([]byte, len(data))
+	go func() {
+		if _, err := io.ReadFull(s, got); err != nil {
+			done <- err
+			return
+		}
+		_, err := s.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Fatalf("want EOF after data, got %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("transfer timeout")
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+	s.Close()
+}
+
+func TestUDPDatagram(t *testing.T) {
+	a, b := newMemPair(0, 0)
+	l := tcp.ListenPacket(a, false)
+	defer l.Close()
+	c, err := tcp.DialPacket(b, a.LocalAddr(), false, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := accept(t, l, 5*time.Second)
+	if s == nil {
+		t.Fatal("accept timeout")
+	}
+	msgs := []string{"a", "bcd", "efghij"}
+	for _, m := range msgs {
+		c.Write([]byte(m))
+	}
+	buf := make([]byte, 64)
+	for _, m := range msgs {
+		n, err := s.Read(buf)
+		if err != nil || string(buf[:n]) != m {
+			t.Fatalf("want %q, got %q %v", m, buf[:n], err)
+		}
+	}
+	//不读取时接收队列有界，超出丢弃
+	for i := 0; i < 1500; i++ {
+		c.Write([]byte{byte(i)})
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Close()
+	count := 0
+	for {
+		_, err := s.Read(buf)
+		if err != nil {
+			break
+		}
+		count++
+	}
+	if count != 1024 {
+		t.Fatalf("want 1024 queued datagrams, got %v", count)
+	}
+	s.Close()
+}
+
+func TestReconnectDelay(t *testing.T) {
+	policies := []*tcp.ReconnectPolicy{
+		{Base: time.Second, Multiplier: 2},
+		{Base: time.Second, Multiplier: 2, Jitter: true},
+		{Base: time.Second, Max: time.Minute, Multiplier: 2},
+		{Base: time.Second, Max: time.Minute, Multiplier: 2, Jitter: true},
+		{Base: time.Second, Multiplier: 1e10, Jitter: true},
+	}
+	for i, p := range policies {
+		prev := time.Duration(0)
+		for attempt := 1; attempt <= 200; attempt++ {
+			d := p.Delay(attempt)
+			if d <= 0 {
+				t.Fatalf("policy %v attempt %v delay %v", i, attempt, d)
+			}
+			if p.Max > 0 && d > p.Max {
+				t.Fatalf("policy %v attempt %v delay %v > max", i, attempt, d)
+			}
+			if !p.Jitter && d < prev {
+				t.Fatalf("policy %v attempt %v delay %v < %v", i, attempt, d, prev)
+			}
+			prev = d
+		}
+	}
+	if d := policies[2].Delay(100); d != time.Minute {
+		t.Fatalf("want max, got %v", d)
+	}
+}
+
+func TestUDPHandshake(t *testing.T) {
+	a, b := newMemPair(0, 0)
+	l := tcp.ListenPacket(a, true)
+	defer l.Close()
+	//未握手的数据包及伪造cookie不创建会话
+	b.WriteTo([]byte{0x01, 'x'}, a.LocalAddr())
+	b.WriteTo(append([]byte{0x11}, make([]byte, 20)...), a.LocalAddr())
+	b.WriteTo([]byte{0x03, 1, 2, 3, 4, 5, 6, 7, 8}, a.LocalAddr())
+	if s := accept(t, l, 300*time.Millisecond); s != nil {
+		t.Fatal("session created without handshake")
+	}
+	b.Close()
+	//对端无响应时握手超时
+	x, _ := newMemPair(0, 0)
+	if _, err := tcp.DialPacket(x, memAddr("nowhere"), true, 500*time.Millisecond); err != tcp.ErrUDPHandshake {
+		t.Fatalf("want handshake timeout, got %v", err)
+	}
+}
+
+func TestUDPSynPadding(t *testing.T) {
+	a, b := newMemPair(0, 0)
+	l := tcp.ListenPacket(a, false)
+	defer l.Close()
+	defer b.Close()
+	ch := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := b.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			ch <- append([]byte{}, buf[:n]...)
+		}
+	}()
+	reply := func() []byte {
+		select {
+		case p := <-ch:
+			return p
+		case <-time.After(300 * time.Millisecond):
+			return nil
+		}
+	}
+	//未填充的syn不应答，避免放大
+	b.WriteTo([]byte{0x03}, a.LocalAddr())
+	if p := reply(); p != nil {
+		t.Fatalf("reply to short syn %v", p)
+	}
+	//填充后下发cookie，应答不大于请求
+	syn := make([]byte, 64)
+	syn[0] = 0x03
+	b.WriteTo(syn, a.LocalAddr())
+	p := reply()
+	if p == nil || p[0] != 0x04 || len(p) > len(syn) {
+		t.Fatalf("cookie reply %v", p)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  [][]byte
+		proto string
+	}{
+		{"get", [][]byte{[]byte("GET / HTTP/1.1\r\n\r\n")}, "ws"},
+		//首段只到达部分方法名
+		{"partial", [][]byte{[]byte("G"), []byte("E"), []byte("T / HTTP/1.1\r\n\r\n")}, "ws"},
+		{"clienthello", [][]byte{{0x16}, {0x03, 0x01, 0x00, 0x05, 0x01, 0x00, 0x00, 0x01, 0x00}}, "wss"},
+		{"binary", [][]byte{{0x00, 0x00, 0x00, 0x04, 0xde, 0xad, 0xbe, 0xef}}, "tcp"},
+		//小端包长低字节为0x16或'G'的tcp帧
+		{"frame16", [][]byte{{0x16, 0x00, 0x00, 0x00}, []byte("0123456789abcdefghijk")}, "tcp"},
+		{"frameG", [][]byte{{'G'}, {0x00, 0x00, 0x00}, []byte("0123456789abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ0")}, "tcp"},
+		{"frameGE", [][]byte{[]byte("GE"), {0x00, 0x00}}, "tcp"},
+		//只到达首字节，超时后按tcp处理
+		{"stall16", [][]byte{{0x16}}, "tcp"},
+		{"stallG", [][]byte{{'G'}}, "tcp"},
+	}
+	for _, tc := range cases {
+		c, peer := net.Pipe()
+		go func(data [][]byte) {
+			for _, b := range data {
+				peer.Write(b)
+			}
+		}(tc.data)
+		p, proto := tcp.Sniff(c, 300*time.Millisecond)
+		if proto != tc.proto {
+			t.Fatalf("%v want %v, got %v", tc.name, tc.proto, proto)
+		}
+		//预读数据可重新读取
+		want := bytes.Join(tc.data, nil)
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(p, got); err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("%v want %q, got %q %v", tc.name, want, got, err)
+		}
+		p.Close()
+		peer.Close()
+	}
+	//不发数据的连接超时后按tcp处理
+	c, peer := net.Pipe()
+	defer peer.Close()
+	start := time.Now()
+	p, proto := tcp.Sniff(c, 200*time.Millisecond)
+	if proto != "tcp" {
+		t.Fatalf("silent want tcp, got %v", proto)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond || d > 2*time.Second {
+		t.Fatalf("silent sniff took %v", d)
+	}
+	//超时后连接仍可读
+	go peer.Write([]byte("x"))
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(p, b); err != nil || b[0] != 'x' {
+		t.Fatalf("read after sniff timeout %q %v", b, err)
+	}
+	p.Close()
+}
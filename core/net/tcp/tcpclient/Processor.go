@@ -1,16 +1,22 @@
 package tcpclient
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cwloo/gonet/core/base/mq"
 	"github.com/cwloo/gonet/core/cb"
 	"github.com/cwloo/gonet/core/net/conn"
 	"github.com/cwloo/gonet/core/net/keepalive"
+	"github.com/cwloo/gonet/core/net/rpc"
 	"github.com/cwloo/gonet/core/net/tcp"
 	"github.com/cwloo/gonet/core/net/transmit"
 	"github.com/cwloo/gonet/core/net/transmit/tcpchannel"
@@ -21,12 +27,27 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+var (
+	ErrNoRPC = errors.New("rpc not set")
+)
+
 // TCP客户端
 type Processor struct {
 	name            string
 	hold            conn.HoldType
 	peers           conn.Sessions
+	hwm             int
+	policy          mq.Policy
+	batchCount      int
+	batchSize       int
+	complete        conn.CompleteType
+	heartbeat       *tcp.Heartbeat
+	idleTimeout     time.Duration
+	idleSet         bool
 	connector       tcp.Connector
+	rpc             *rpc.Client
+	l               *sync.RWMutex
+	peer            conn.Session
 	onConnected     cb.OnConnected
 	onClosed        cb.OnClosed
 	onMessage       cb.OnMessage
@@ -38,6 +59,7 @@ func NewTCPClient(name string, address ...string) TCPClient {
 		name:      name,
 		hold:      conn.KHoldNone,
 		peers:     conn.NewSessions(),
+		l:         &sync.RWMutex{},
 		connector: tcp.NewConnector(name, address...)}
 	s.connector.SetDialTimeout(10 * time.Second)
 	s.connector.SetIdleTimeout(30 * time.Second)
@@ -80,12 +102,89 @@ func (s *Processor) SetHoldType(hold conn.HoldType) {
 	s.hold = hold
 }
 
+// 设置会话发送队列高水位及队列满处理策略，size<=0不限制
+// mq.KBlock 无超时，队列满时Write阻塞直到写协程腾出空位
+func (s *Processor) SetHighWaterMark(size int, policy mq.Policy) {
+	s.hwm = size
+	s.policy = policy
+}
+
+// 应用层心跳，nil关闭
+func (s *Processor) SetHeartbeat(hb *tcp.Heartbeat) {
+	s.heartbeat = hb
+}
+
+// 设置会话合并写，count<=0关闭，size<=0不限制批次字节数
+func (s *Processor) SetWriteBatch(count, size int, complete conn.CompleteType) {
+	s.batchCount = count
+	s.batchSize = size
+	s.complete = complete
+}
+
 func (s *Processor) Range(cb func(peer conn.Session)) {
 	if conn.KHold == s.hold {
 		s.peers.Range(cb)
 	}
 }
 
+// 当前连接会话，未连接返回nil
+func (s *Processor) Peer() (peer conn.Session) {
+	s.l.RLock()
+	peer = s.peer
+	s.l.RUnlock()
+	return
+}
+
+func (s *Processor) setPeer(peer conn.Session) {
+	s.l.Lock()
+	s.peer = peer
+	s.l.Unlock()
+}
+
+func (s *Processor) resetPeer(peer conn.Session) {
+	s.l.Lock()
+	if s.peer == peer {
+		s.peer = nil
+	}
+	s.l.Unlock()
+}
+
+// 启用RPC，须在ConnectTCP前调用，启用后非响应消息以*packet.Msg交给消息回调
+// encType 请求编码类型(packet.ENC_xxx)，d 默认超时
+func (s *Processor) SetRPC(order binary.ByteOrder, encType uint8, d time.Duration) {
+	s.rpc = rpc.NewClient(order, encType, d)
+}
+
+// 经当前连接同步调用，cmd为packet.Enword(mainID, subID)，resp为响应解码目标(指针)
+func (s *Processor) Call(ctx context.Context, cmd uint32, req any, resp any) error {
+	if s.rpc == nil {
+		return ErrNoRPC
+	}
+	peer := s.Peer()
+	if peer == nil {
+		return rpc.ErrDisconnected
+	}
+	return s.rpc.Call(ctx, peer, cmd, req, resp)
+}
+
+// 同步调用，返回*T响应
+func Invoke[T any](ctx context.Context, c TCPClient, cmd uint32, req any) (*T, error) {
+	resp := new(T)
+	err := c.Call(ctx, cmd, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// 启用RPC时先匹配响应/结束等待
+func (s *Processor) callbacks() (cb.OnClosed, cb.OnMessage) {
+	if s.rpc == nil {
+		return s.onClosed, s.onMessage
+	}
+	return s.rpc.OnClosed(s.onClosed), s.rpc.OnMessage(s.onMessage)
+}
+
 func (s *Processor) assertConnector() {
 	if s.connector == nil {
 		panic(errors.New("error"))
@@ -107,10 +206,13 @@ func (s *Processor) SetDialTimeout(d time.Duration) {
 	s.connector.SetDialTimeout(d)
 }
 
+// 会话空闲超时，d为检查间隔，首次调用初始化全局定时轮盘，之后调用的d不生效，沿用首次检查间隔
+// 各服务/客户端可设置不同超时(按秒向上取整)，timeout<=0不检查空闲，会话可再调用conn.Session.SetIdleTimeout修改
 func (s *Processor) SetIdleTimeout(timeout, d time.Duration) {
 	s.assertConnector()
 	s.connector.SetIdleTimeout(d)
 	keepalive.Init(timeout, d)
+	s.idleTimeout, s.idleSet = timeout, true
 }
 
 func (s *Processor) SetRetryInterval(d time.Duration) {
@@ -118,6 +220,34 @@ func (s *Processor) SetRetryInterval(d time.Duration) {
 	s.connector.SetRetryInterval(d)
 }
 
+// 重连策略，指数退避+全抖动，nil为固定间隔无限重试
+func (s *Processor) SetReconnectPolicy(policy *tcp.ReconnectPolicy) {
+	s.assertConnector()
+	s.connector.SetReconnectPolicy(policy)
+}
+
+func (s *Processor) SetRetryCallback(cb cb.OnRetry) {
+	s.assertConnector()
+	s.connector.SetRetryCallback(cb)
+}
+
+func (s *Processor) SetGiveUpCallback(cb cb.OnGiveUp) {
+	s.assertConnector()
+	s.connector.SetGiveUpCallback(cb)
+}
+
+// wss/tls/tcps客户端TLS配置，双向认证时设置Certificates
+func (s *Processor) SetTLSConfig(config *tls.Config) {
+	s.assertConnector()
+	s.connector.SetTLSConfig(config)
+}
+
+// websocket压缩/消息大小/请求的子协议
+func (s *Processor) SetWSOptions(opt *tcp.WSOptions) {
+	s.assertConnector()
+	s.connector.SetWSOptions(opt)
+}
+
 func (s *Processor) SetProtocolCallback(cb cb.OnProtocol) {
 	s.assertConnector()
 	s.connector.SetProtocolCallback(cb)
@@ -146,7 +276,7 @@ func (s *Processor) SetWriteCompleteCallback(cb cb.OnWriteComplete) {
 
 func (s *Processor) newConnection(c any, channel transmit.Channel, protoName string, peerRegion *conn.Region, v ...any) {
 	switch protoName {
-	case "tcp":
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
 		if p, ok := c.(net.Conn); ok {
 			connID := conn.NewConnID()
 			localAddr := p.LocalAddr().String()
@@ -157,14 +287,22 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 				c,
 				conn.KClient,
 				channel, localAddr, peerAddr, protoName, peerRegion, s.connector.GetIdleTimeout())
+			onClosed, onMessage := s.callbacks()
 			peer.(*tcp.TCPConnection).SetConnectedCallback(s.onConnected)
-			peer.(*tcp.TCPConnection).SetClosedCallback(s.onClosed)
-			peer.(*tcp.TCPConnection).SetMessageCallback(s.onMessage)
+			peer.(*tcp.TCPConnection).SetClosedCallback(onClosed)
+			peer.(*tcp.TCPConnection).SetMessageCallback(onMessage)
 			peer.(*tcp.TCPConnection).SetWriteCompleteCallback(s.onWriteComplete)
 			peer.(*tcp.TCPConnection).SetCloseCallback(s.removeConnection)
 			peer.(*tcp.TCPConnection).SetErrorCallback(s.onConnectionError)
 			peer.(*tcp.TCPConnection).SetEstablishCallback(s.remove)
 			peer.(*tcp.TCPConnection).SetDestroyCallback(s.reset)
+			peer.(*tcp.TCPConnection).SetHighWaterMark(s.hwm, s.policy)
+			peer.(*tcp.TCPConnection).SetWriteBatch(s.batchCount, s.batchSize, s.complete)
+			peer.(*tcp.TCPConnection).SetHeartbeat(s.heartbeat)
+			if s.idleSet {
+				peer.(*tcp.TCPConnection).SetIdleTimeout(s.idleTimeout)
+			}
+			s.setPeer(peer)
 			peer.(*tcp.TCPConnection).ConnectEstablished(v...)
 			// save peer first, otherwise it will be dtcor immediately
 			if conn.KHoldNone != s.hold && !s.peers.Add(peer) {
@@ -184,14 +322,23 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 				c,
 				conn.KClient,
 				channel, localAddr, peerAddr, protoName, peerRegion, s.connector.GetIdleTimeout())
+			onClosed, onMessage := s.callbacks()
 			peer.(*tcp.TCPConnection).SetConnectedCallback(s.onConnected)
-			peer.(*tcp.TCPConnection).SetClosedCallback(s.onClosed)
-			peer.(*tcp.TCPConnection).SetMessageCallback(s.onMessage)
+			peer.(*tcp.TCPConnection).SetClosedCallback(onClosed)
+			peer.(*tcp.TCPConnection).SetMessageCallback(onMessage)
 			peer.(*tcp.TCPConnection).SetWriteCompleteCallback(s.onWriteComplete)
 			peer.(*tcp.TCPConnection).SetCloseCallback(s.removeConnection)
 			peer.(*tcp.TCPConnection).SetErrorCallback(s.onConnectionError)
 			peer.(*tcp.TCPConnection).SetEstablishCallback(s.remove)
 			peer.(*tcp.TCPConnection).SetDestroyCallback(s.reset)
+			peer.(*tcp.TCPConnection).SetHighWaterMark(s.hwm, s.policy)
+			peer.(*tcp.TCPConnection).SetWriteBatch(s.batchCount, s.batchSize, s.complete)
+			peer.(*tcp.TCPConnection).SetHeartbeat(s.heartbeat)
+			if s.idleSet {
+				peer.(*tcp.TCPConnection).SetIdleTimeout(s.idleTimeout)
+			}
+			peer.(*tcp.TCPConnection).SetWSState(tcp.WSStateOf(v...))
+			s.setPeer(peer)
 			peer.(*tcp.TCPConnection).ConnectEstablished(v...)
 			// save peer first, otherwise it will be dtcor immediately
 			if conn.KHoldNone != s.hold && !s.peers.Add(peer) {
@@ -207,7 +354,7 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 
 func (s *Processor) onProtocol(proto string) transmit.Channel {
 	switch proto {
-	case "tcp":
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
 		return tcpchannel.NewChannel()
 	case "ws", "wss":
 		return wschannel.NewChannel()
@@ -220,6 +367,12 @@ func (s *Processor) ConnectTCP(header http.Header, address ...string) {
 	s.connector.ConnectTCP(header, address...)
 }
 
+// 同ConnectTCP，地址解析或首次连接失败时返回错误
+func (s *Processor) Dial(header http.Header, address ...string) error {
+	s.assertConnector()
+	return s.connector.Dial(header, address...)
+}
+
 func (s *Processor) onConnectError(proto string, err error) {
 }
 
@@ -248,10 +401,15 @@ func (s *Processor) OnWriteComplete(peer conn.Session) {
 }
 
 func (s *Processor) removeConnection(peer conn.Session) {
+	s.resetPeer(peer)
 	peer.(*tcp.TCPConnection).ConnectDestroyed()
 	s.assertConnector()
 	if s.connector.Retry() {
-		s.connector.Reconnect()
+		//设置重连策略后仅对端关闭时自动重连
+		policy := s.connector.ReconnectPolicy()
+		if policy == nil || (policy.AutoReconnect && peer.(*tcp.TCPConnection).Reason().Id == conn.KPeerClosed) {
+			s.connector.Reconnect()
+		}
 	}
 }
 
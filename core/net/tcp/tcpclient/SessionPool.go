@@ -0,0 +1,408 @@
+package tcpclient
+
+import (
+	"container/list"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/tcp"
+	logs "github.com/cwloo/gonet/logs"
+)
+
+var (
+	ErrPoolClosed = errors.New("session pool closed")
+)
+
+// 后端会话池，维持min~max个到同一地址的会话
+// 借出时健康检查，耗尽时等待至ctx超时，空闲超时回收至min，对端关闭的会话自动补充
+type SessionPool interface {
+	Start(header http.Header) error
+	Close()
+	Get(ctx context.Context) (conn.Session, error)
+	Put(peer conn.Session)
+	Len() (idle, total int)
+	SetSize(min, max int)
+	SetIdleEviction(d time.Duration)
+	SetHealthCheck(check func(peer conn.Session) bool)
+	SetDialTimeout(d time.Duration)
+	SetIdleTimeout(timeout, d time.Duration)
+	SetTLSConfig(config *tls.Config)
+	SetWSOptions(opt *tcp.WSOptions)
+	SetProtocolCallback(cb cb.OnProtocol)
+	SetConnectedCallback(cb cb.OnConnected)
+	SetClosedCallback(cb cb.OnClosed)
+	SetMessageCallback(cb cb.OnMessage)
+}
+
+// 空闲会话
+type idleSession struct {
+	peer conn.Session
+	t    time.Time
+}
+
+// 等待结果，连接失败时err非nil
+type grant struct {
+	peer conn.Session
+	err  error
+}
+
+type sessionPool struct {
+	l           *sync.Mutex
+	dl          *sync.Mutex
+	client      TCPClient
+	header      http.Header
+	min, max    int
+	idleD       time.Duration
+	check       func(peer conn.Session) bool
+	idle        *list.List
+	waiters     *list.List
+	borrowed    map[int64]conn.Session
+	sessions    map[int64]conn.Session
+	dialing     int
+	started     bool
+	closed      bool
+	stop        chan struct{}
+	onConnected cb.OnConnected
+	onClosed    cb.OnClosed
+}
+
+func NewSessionPool(name, address string) SessionPool {
+	s := &sessionPool{
+		l:        &sync.Mutex{},
+		dl:       &sync.Mutex{},
+		client:   NewTCPClient(name, address),
+		min:      1,
+		max:      8,
+		idleD:    time.Minute,
+		idle:     list.New(),
+		waiters:  list.New(),
+		borrowed: map[int64]conn.Session{},
+		sessions: map[int64]conn.Session{},
+		stop:     make(chan struct{}),
+	}
+	s.client.SetConnectedCallback(s.peerConnected)
+	s.client.SetClosedCallback(s.peerClosed)
+	return s
+}
+
+// 最少/最多会话数
+func (s *sessionPool) SetSize(min, max int) {
+	if min < 0 || max <= 0 || min > max {
+		logs.Fatalf("error")
+	}
+	s.l.Lock()
+	s.min, s.max = min, max
+	s.l.Unlock()
+}
+
+// 超出min的会话空闲d后关闭
+func (s *sessionPool) SetIdleEviction(d time.Duration) {
+	s.idleD = d
+}
+
+// 借出前检查，返回false时关闭该会话重新获取，缺省仅检查是否连接
+func (s *sessionPool) SetHealthCheck(check func(peer conn.Session) bool) {
+	s.check = check
+}
+
+func (s *sessionPool) SetDialTimeout(d time.Duration) {
+	s.client.SetDialTimeout(d)
+}
+
+func (s *sessionPool) SetIdleTimeout(timeout, d time.Duration) {
+	s.client.SetIdleTimeout(timeout, d)
+}
+
+func (s *sessionPool) SetTLSConfig(config *tls.Config) {
+	s.client.SetTLSConfig(config)
+}
+
+func (s *sessionPool) SetWSOptions(opt *tcp.WSOptions) {
+	s.client.SetWSOptions(opt)
+}
+
+func (s *sessionPool) SetProtocolCallback(cb cb.OnProtocol) {
+	s.client.SetProtocolCallback(cb)
+}
+
+func (s *sessionPool) SetConnectedCallback(cb cb.OnConnected) {
+	s.onConnected = cb
+}
+
+func (s *sessionPool) SetClosedCallback(cb cb.OnClosed) {
+	s.onClosed = cb
+}
+
+func (s *sessionPool) SetMessageCallback(cb cb.OnMessage) {
+	s.client.SetMessageCallback(cb)
+}
+
+func (s *sessionPool) Len() (idle, total int) {
+	s.l.Lock()
+	idle, total = s.idle.Len(), len(s.sessions)
+	s.l.Unlock()
+	return
+}
+
+// 预建min个会话并开始空闲回收，返回首个连接错误
+func (s *sessionPool) Start(header http.Header) (err error) {
+	s.l.Lock()
+	if s.started || s.closed {
+		s.l.Unlock()
+		return
+	}
+	s.started = true
+	s.header = header
+	n := s.min - len(s.sessions) - s.dialing
+	s.dialing += n
+	s.l.Unlock()
+	for i := 0; i < n; i++ {
+		if e := s.dial(); e != nil && err == nil {
+			err = e
+		}
+	}
+	go s.run()
+	return
+}
+
+func (s *sessionPool) Close() {
+	s.l.Lock()
+	if s.closed {
+		s.l.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	//关闭池创建的全部会话，包括借出中的
+	peers := []conn.Session{}
+	for _, peer := range s.sessions {
+		peers = append(peers, peer)
+	}
+	s.idle.Init()
+	for e := s.waiters.Front(); e != nil; e = e.Next() {
+		e.Value.(chan grant) <- grant{err: ErrPoolClosed}
+	}
+	s.waiters.Init()
+	s.l.Unlock()
+	s.client.Disconnect()
+	for _, peer := range peers {
+		peer.Close()
+	}
+}
+
+// 获取会话，耗尽时等待归还或新建，用完须Put归还
+func (s *sessionPool) Get(ctx context.Context) (conn.Session, error) {
+	for {
+		s.l.Lock()
+		if s.closed {
+			s.l.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if e := s.idle.Back(); e != nil {
+			//后进先出，较早归还的会话空闲后回收
+			peer := s.idle.Remove(e).(*idleSession).peer
+			s.borrowed[peer.ID()] = peer
+			s.l.Unlock()
+			if s.healthy(peer) {
+				return peer, nil
+			}
+			s.discard(peer)
+			continue
+		}
+		w := make(chan grant, 1)
+		elem := s.waiters.PushBack(w)
+		dial := len(s.sessions)+s.dialing < s.max
+		if dial {
+			s.dialing++
+		}
+		s.l.Unlock()
+		if dial {
+			go s.dial()
+		}
+		select {
+		case g := <-w:
+			if g.err != nil {
+				return nil, g.err
+			}
+			if s.healthy(g.peer) {
+				return g.peer, nil
+			}
+			s.discard(g.peer)
+		case <-ctx.Done():
+			s.l.Lock()
+			select {
+			case g := <-w:
+				s.l.Unlock()
+				if g.peer != nil {
+					s.Put(g.peer)
+				}
+			default:
+				s.waiters.Remove(elem)
+				s.l.Unlock()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// 归还会话，已断开的会话丢弃
+func (s *sessionPool) Put(peer conn.Session) {
+	s.l.Lock()
+	if _, ok := s.borrowed[peer.ID()]; !ok {
+		s.l.Unlock()
+		return
+	}
+	delete(s.borrowed, peer.ID())
+	switch {
+	case s.closed:
+		s.l.Unlock()
+		peer.Close()
+	case !peer.Connected():
+		s.l.Unlock()
+	default:
+		s.release(peer)
+		s.l.Unlock()
+	}
+}
+
+// 交给等待者或放回空闲队列
+func (s *sessionPool) release(peer conn.Session) {
+	if e := s.waiters.Front(); e != nil {
+		s.waiters.Remove(e)
+		s.borrowed[peer.ID()] = peer
+		e.Value.(chan grant) <- grant{peer: peer}
+		return
+	}
+	s.idle.PushBack(&idleSession{peer: peer, t: time.Now()})
+}
+
+func (s *sessionPool) healthy(peer conn.Session) bool {
+	if !peer.Connected() {
+		return false
+	}
+	return s.check == nil || s.check(peer)
+}
+
+// 关闭未通过健康检查的借出会话
+func (s *sessionPool) discard(peer conn.Session) {
+	s.l.Lock()
+	delete(s.borrowed, peer.ID())
+	s.l.Unlock()
+	peer.Close()
+}
+
+// 须先增加dialing计数，串行连接避免并发修改connector
+// 连接失败时唤醒最早的等待者
+func (s *sessionPool) dial() error {
+	s.dl.Lock()
+	err := s.client.Dial(s.header)
+	s.dl.Unlock()
+	if err != nil {
+		s.l.Lock()
+		s.dialing--
+		if e := s.waiters.Front(); e != nil {
+			s.waiters.Remove(e)
+			e.Value.(chan grant) <- grant{err: err}
+		}
+		s.l.Unlock()
+	}
+	return err
+}
+
+func (s *sessionPool) peerConnected(peer conn.Session, v ...any) {
+	s.l.Lock()
+	if s.dialing > 0 {
+		s.dialing--
+	}
+	if s.closed {
+		s.l.Unlock()
+		peer.Close()
+		return
+	}
+	s.sessions[peer.ID()] = peer
+	s.release(peer)
+	s.l.Unlock()
+	if s.onConnected != nil {
+		s.onConnected(peer, v...)
+	}
+}
+
+func (s *sessionPool) peerClosed(peer conn.Session, reason conn.Reason, v ...any) {
+	s.l.Lock()
+	//池关闭后建立的会话未计数
+	if _, ok := s.sessions[peer.ID()]; !ok {
+		s.l.Unlock()
+		return
+	}
+	delete(s.sessions, peer.ID())
+	for e := s.idle.Front(); e != nil; e = e.Next() {
+		if e.Value.(*idleSession).peer == peer {
+			s.idle.Remove(e)
+			break
+		}
+	}
+	total := len(s.sessions)
+	//对端关闭时补充，否则维持min
+	replace := !s.closed && total+s.dialing < s.max &&
+		(reason.Id == conn.KPeerClosed || total+s.dialing < s.min || s.waiters.Len() > 0)
+	if replace {
+		s.dialing++
+	}
+	s.l.Unlock()
+	if replace {
+		go s.dial()
+	}
+	if s.onClosed != nil {
+		s.onClosed(peer, reason, v...)
+	}
+}
+
+func (s *sessionPool) run() {
+	d := s.idleD / 2
+	if d <= 0 || d > time.Second {
+		d = time.Second
+	}
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.evict()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// 回收超出min的空闲会话，不足min时补充
+func (s *sessionPool) evict() {
+	peers := []conn.Session{}
+	s.l.Lock()
+	n := len(s.sessions) - s.min
+	var next *list.Element
+	for e := s.idle.Front(); e != nil && n > 0 && s.idleD > 0; e = next {
+		next = e.Next()
+		if it := e.Value.(*idleSession); time.Since(it.t) >= s.idleD {
+			s.idle.Remove(e)
+			peers = append(peers, it.peer)
+			n--
+		}
+	}
+	dial := s.min - len(s.sessions) - s.dialing
+	if dial > 0 {
+		s.dialing += dial
+	}
+	s.l.Unlock()
+	for _, peer := range peers {
+		peer.Close()
+	}
+	for i := 0; i < dial; i++ {
+		go s.dial()
+	}
+}
@@ -1,11 +1,16 @@
 package tcpclient
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"net/http"
 	"time"
 
+	"github.com/cwloo/gonet/core/base/mq"
 	"github.com/cwloo/gonet/core/cb"
 	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/tcp"
 )
 
 // TCP客户端
@@ -13,15 +18,27 @@ type TCPClient interface {
 	Name() string
 	Peers() conn.Sessions
 	ConnectTCP(header http.Header, address ...string)
+	Dial(header http.Header, address ...string) error
 	Reconnect()
 	Disconnect()
 	Retry() bool
 	EnableRetry(retry bool)
 	Range(cb func(peer conn.Session))
+	Peer() conn.Session
+	Call(ctx context.Context, cmd uint32, req any, resp any) error
+	SetRPC(order binary.ByteOrder, encType uint8, d time.Duration)
 	SetHoldType(hold conn.HoldType)
+	SetHighWaterMark(size int, policy mq.Policy)
+	SetWriteBatch(count, size int, complete conn.CompleteType)
+	SetHeartbeat(hb *tcp.Heartbeat)
 	SetDialTimeout(d time.Duration)
 	SetIdleTimeout(timeout, d time.Duration)
 	SetRetryInterval(d time.Duration)
+	SetReconnectPolicy(policy *tcp.ReconnectPolicy)
+	SetRetryCallback(cb cb.OnRetry)
+	SetGiveUpCallback(cb cb.OnGiveUp)
+	SetTLSConfig(config *tls.Config)
+	SetWSOptions(opt *tcp.WSOptions)
 	SetProtocolCallback(cb cb.OnProtocol)
 	SetConnectErrorCallback(cb cb.OnConnectError)
 	SetConnectedCallback(cb cb.OnConnected)
@@ -0,0 +1,91 @@
+package tcpcluster
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/tcp/tcpclient"
+)
+
+// 节点
+type endpoint struct {
+	l       *sync.Mutex
+	address string
+	client  tcpclient.TCPClient
+	peer    conn.Session
+	healthy bool
+	probing bool //连接/探测中
+	removed bool
+	fails   int
+	pending int32
+}
+
+func newEndpoint(address string) *endpoint {
+	return &endpoint{l: &sync.Mutex{}, address: address}
+}
+
+// 可用会话
+func (s *endpoint) session() (peer conn.Session) {
+	s.l.Lock()
+	if s.healthy && s.peer != nil && s.peer.Connected() {
+		peer = s.peer
+	}
+	s.l.Unlock()
+	return
+}
+
+// 标记健康状态，返回是否变化
+func (s *endpoint) mark(healthy bool) (changed bool) {
+	s.l.Lock()
+	changed = s.healthy != healthy
+	s.healthy = healthy
+	if healthy {
+		s.fails = 0
+	} else {
+		s.fails++
+	}
+	s.l.Unlock()
+	return
+}
+
+// 未连接且未在连接中时开始连接
+func (s *endpoint) startProbe() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.probing || s.removed || (s.peer != nil && s.healthy) {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+func (s *endpoint) endProbe() {
+	s.l.Lock()
+	s.probing = false
+	s.l.Unlock()
+}
+
+func (s *endpoint) Pending() int32 {
+	return atomic.LoadInt32(&s.pending)
+}
+
+// rendezvous哈希权重
+func (s *endpoint) weight(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{'#'})
+	h.Write([]byte(s.address))
+	return mix(h.Sum64())
+}
+
+// fnv对相近地址区分度不足，末尾混淆使权重均匀(murmur3 fmix64)
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
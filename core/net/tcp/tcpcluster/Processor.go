@@ -0,0 +1,424 @@
+package tcpcluster
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/rpc"
+	"github.com/cwloo/gonet/core/net/tcp"
+	"github.com/cwloo/gonet/core/net/tcp/tcpclient"
+	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/pool"
+)
+
+// pool.Update返回非nil时移除元素
+var errRemove = errors.New("remove")
+
+// 多节点客户端
+type Processor struct {
+	name        string
+	l           *sync.Mutex
+	endpoints   *pool.Pool
+	balance     Balance
+	next        uint32
+	header      http.Header
+	started     bool
+	stop        chan struct{}
+	resolver    Resolver
+	resolveD    time.Duration
+	resolveTime time.Time
+	probeD      time.Duration
+	probe       func(peer conn.Session) bool
+	dialTimeout time.Duration
+	timeout, d  time.Duration
+	tlsConfig   *tls.Config
+	wsOptions   *tcp.WSOptions
+	onProtocol  cb.OnProtocol
+	onConnected cb.OnConnected
+	onClosed    cb.OnClosed
+	onMessage   cb.OnMessage
+	onHealth    func(address string, healthy bool)
+}
+
+func NewTCPCluster(name string, address ...string) TCPCluster {
+	s := &Processor{
+		name:        name,
+		l:           &sync.Mutex{},
+		endpoints:   pool.NewPool(),
+		probeD:      3 * time.Second,
+		dialTimeout: 10 * time.Second,
+	}
+	for _, addr := range address {
+		if err := s.Add(addr); err != nil {
+			logs.Errorf(err.Error())
+		}
+	}
+	return s
+}
+
+func (s *Processor) Name() string {
+	return s.name
+}
+
+func (s *Processor) SetBalance(balance Balance) {
+	s.balance = balance
+}
+
+// 节点发现，每d刷新一次，新增节点自动连接，消失节点移除
+func (s *Processor) SetResolver(resolver Resolver, d time.Duration) {
+	s.resolver = resolver
+	s.resolveD = d
+}
+
+// 每d探测一次不可用节点，重新连接成功且probe返回true后恢复，probe为nil时连接成功即恢复
+func (s *Processor) SetProbe(d time.Duration, probe func(peer conn.Session) bool) {
+	if d > 0 {
+		s.probeD = d
+	}
+	s.probe = probe
+}
+
+func (s *Processor) SetDialTimeout(d time.Duration) {
+	s.dialTimeout = d
+}
+
+func (s *Processor) SetIdleTimeout(timeout, d time.Duration) {
+	s.timeout, s.d = timeout, d
+}
+
+func (s *Processor) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+func (s *Processor) SetWSOptions(opt *tcp.WSOptions) {
+	s.wsOptions = opt
+}
+
+func (s *Processor) SetProtocolCallback(cb cb.OnProtocol) {
+	s.onProtocol = cb
+}
+
+func (s *Processor) SetConnectedCallback(cb cb.OnConnected) {
+	s.onConnected = cb
+}
+
+func (s *Processor) SetClosedCallback(cb cb.OnClosed) {
+	s.onClosed = cb
+}
+
+func (s *Processor) SetMessageCallback(cb cb.OnMessage) {
+	s.onMessage = cb
+}
+
+// 节点健康状态变化回调
+func (s *Processor) SetHealthCallback(cb func(address string, healthy bool)) {
+	s.onHealth = cb
+}
+
+func (s *Processor) find(address string) (ep *endpoint) {
+	s.endpoints.Range(func(value any) {
+		if value.(*endpoint).address == address {
+			ep = value.(*endpoint)
+		}
+	})
+	return
+}
+
+// 添加节点，已启动时立即连接
+func (s *Processor) Add(address string) error {
+	if _, err := conn.ParseAddress(address); err != nil {
+		return err
+	}
+	s.l.Lock()
+	if s.find(address) != nil {
+		s.l.Unlock()
+		return ErrExist
+	}
+	ep := newEndpoint(address)
+	started := s.started
+	if started {
+		s.newClient(ep)
+	}
+	s.endpoints.Put(ep)
+	s.l.Unlock()
+	if started && ep.startProbe() {
+		go s.connect(ep)
+	}
+	return nil
+}
+
+// 移除节点并关闭连接
+func (s *Processor) Remove(address string) {
+	var removed *endpoint
+	s.l.Lock()
+	s.endpoints.Update(func(value any, _ func(error, ...any)) error {
+		if ep := (*value.(*any)).(*endpoint); ep.address == address {
+			removed = ep
+			return errRemove
+		}
+		return nil
+	})
+	s.l.Unlock()
+	if removed != nil {
+		s.close(removed)
+	}
+}
+
+func (s *Processor) close(ep *endpoint) {
+	ep.l.Lock()
+	ep.removed = true
+	peer := ep.peer
+	ep.l.Unlock()
+	if ep.client != nil {
+		ep.client.Disconnect()
+	}
+	if peer != nil {
+		peer.Close()
+	}
+}
+
+func (s *Processor) Range(cb func(address string, peer conn.Session, healthy bool)) {
+	s.endpoints.Range(func(value any) {
+		ep := value.(*endpoint)
+		ep.l.Lock()
+		address, peer, healthy := ep.address, ep.peer, ep.healthy
+		ep.l.Unlock()
+		cb(address, peer, healthy)
+	})
+}
+
+func (s *Processor) newClient(ep *endpoint) {
+	c := tcpclient.NewTCPClient(s.name, ep.address)
+	c.SetDialTimeout(s.dialTimeout)
+	if s.timeout > 0 {
+		c.SetIdleTimeout(s.timeout, s.d)
+	}
+	if s.tlsConfig != nil {
+		c.SetTLSConfig(s.tlsConfig)
+	}
+	if s.wsOptions != nil {
+		c.SetWSOptions(s.wsOptions)
+	}
+	if s.onProtocol != nil {
+		c.SetProtocolCallback(s.onProtocol)
+	}
+	if s.onMessage != nil {
+		c.SetMessageCallback(s.onMessage)
+	}
+	c.SetConnectedCallback(func(peer conn.Session, v ...any) {
+		s.connected(ep, peer, v...)
+	})
+	c.SetClosedCallback(func(peer conn.Session, reason conn.Reason, v ...any) {
+		s.closed(ep, peer, reason, v...)
+	})
+	ep.client = c
+}
+
+// 连接全部节点并开始探测/节点发现
+func (s *Processor) Start(header http.Header) {
+	s.l.Lock()
+	if s.started {
+		s.l.Unlock()
+		return
+	}
+	s.header = header
+	s.started = true
+	s.stop = make(chan struct{})
+	s.endpoints.Range(func(value any) {
+		s.newClient(value.(*endpoint))
+	})
+	s.l.Unlock()
+	s.tick()
+	go s.run(s.stop)
+}
+
+// 停止并移除全部节点
+func (s *Processor) Stop() {
+	s.l.Lock()
+	if !s.started {
+		s.l.Unlock()
+		return
+	}
+	s.started = false
+	close(s.stop)
+	s.l.Unlock()
+	s.endpoints.Reset(func(value any) {
+		s.close(value.(*endpoint))
+	}, false)
+}
+
+func (s *Processor) run(stop chan struct{}) {
+	ticker := time.NewTicker(s.probeD)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.tick()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (s *Processor) tick() {
+	if s.resolver != nil && time.Since(s.resolveTime) >= s.resolveD {
+		s.resolveTime = time.Now()
+		s.resolve()
+	}
+	s.endpoints.Range(func(value any) {
+		ep := value.(*endpoint)
+		if ep.startProbe() {
+			go s.connect(ep)
+		}
+	})
+}
+
+func (s *Processor) resolve() {
+	addrs, err := s.resolver()
+	if err != nil {
+		logs.Errorf("%v %v", s.name, err)
+		return
+	}
+	m := map[string]bool{}
+	for _, addr := range addrs {
+		m[addr] = true
+		if err := s.Add(addr); err != nil && err != ErrExist {
+			logs.Errorf("%v %v", s.name, err)
+		}
+	}
+	removed := []string{}
+	s.Range(func(address string, peer conn.Session, healthy bool) {
+		if !m[address] {
+			removed = append(removed, address)
+		}
+	})
+	for _, addr := range removed {
+		s.Remove(addr)
+	}
+}
+
+// 连接节点，已连接未通过探测时重新探测
+func (s *Processor) connect(ep *endpoint) {
+	ep.l.Lock()
+	peer := ep.peer
+	ep.l.Unlock()
+	if peer != nil && peer.Connected() {
+		s.check(ep, peer)
+		return
+	}
+	if err := ep.client.Dial(s.header); err != nil {
+		ep.endProbe()
+		s.setHealth(ep, false)
+	}
+}
+
+func (s *Processor) connected(ep *endpoint, peer conn.Session, v ...any) {
+	ep.l.Lock()
+	removed := ep.removed
+	ep.peer = peer
+	ep.l.Unlock()
+	if removed {
+		peer.Close()
+		return
+	}
+	if s.onConnected != nil {
+		s.onConnected(peer, v...)
+	}
+	//探测可能发起请求，不能阻塞读协程
+	go s.check(ep, peer)
+}
+
+func (s *Processor) closed(ep *endpoint, peer conn.Session, reason conn.Reason, v ...any) {
+	ep.l.Lock()
+	if ep.peer == peer {
+		ep.peer = nil
+	}
+	ep.l.Unlock()
+	if reason.Id == conn.KSelfClosedExpired {
+		logs.Warnf("%v %v idle timeout", s.name, ep.address)
+	}
+	s.setHealth(ep, false)
+	if s.onClosed != nil {
+		s.onClosed(peer, reason, v...)
+	}
+}
+
+func (s *Processor) check(ep *endpoint, peer conn.Session) {
+	healthy := s.probe == nil || s.probe(peer)
+	ep.endProbe()
+	s.setHealth(ep, healthy && peer.Connected())
+}
+
+func (s *Processor) setHealth(ep *endpoint, healthy bool) {
+	if !ep.mark(healthy) {
+		return
+	}
+	switch healthy {
+	case true:
+		logs.Infof("%v %v up", s.name, ep.address)
+	default:
+		logs.Warnf("%v %v down", s.name, ep.address)
+	}
+	if s.onHealth != nil {
+		s.onHealth(ep.address, healthy)
+	}
+}
+
+// 按负载均衡策略选择可用节点，请求结束后调用done
+func (s *Processor) Pick(key string) (peer conn.Session, done func(), err error) {
+	var eps []*endpoint
+	var peers []conn.Session
+	s.endpoints.Range(func(value any) {
+		ep := value.(*endpoint)
+		if peer := ep.session(); peer != nil {
+			eps = append(eps, ep)
+			peers = append(peers, peer)
+		}
+	})
+	if len(eps) == 0 {
+		return nil, nil, ErrNoEndpoint
+	}
+	i := 0
+	switch s.balance {
+	case KLeastPending:
+		for j := range eps {
+			if eps[j].Pending() < eps[i].Pending() {
+				i = j
+			}
+		}
+	case KConsistentHash:
+		var max uint64
+		for j := range eps {
+			if w := eps[j].weight(key); j == 0 || w > max {
+				i, max = j, w
+			}
+		}
+	default:
+		i = int(atomic.AddUint32(&s.next, 1)-1) % len(eps)
+	}
+	ep := eps[i]
+	atomic.AddInt32(&ep.pending, 1)
+	var once sync.Once
+	return peers[i], func() {
+		once.Do(func() {
+			atomic.AddInt32(&ep.pending, -1)
+		})
+	}, nil
+}
+
+// 选择节点发起RPC调用，c须已包装节点消息/关闭回调(rpc.Client.OnMessage/OnClosed)
+func (s *Processor) Call(ctx context.Context, c *rpc.Client, key string, cmd uint32, req any, resp any) error {
+	peer, done, err := s.Pick(key)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.Call(ctx, peer, cmd, req, resp)
+}
@@ -0,0 +1,56 @@
+package tcpcluster
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/rpc"
+	"github.com/cwloo/gonet/core/net/tcp"
+)
+
+// 负载均衡策略
+type Balance uint8
+
+const (
+	KRoundRobin     Balance = iota //轮询
+	KLeastPending                  //最少在途请求
+	KConsistentHash                //按key一致性哈希，节点增减只影响少量key
+)
+
+var (
+	ErrNoEndpoint = errors.New("no healthy endpoint")
+	ErrExist      = errors.New("endpoint exist")
+)
+
+// 节点发现，返回全部节点地址
+type Resolver func() ([]string, error)
+
+// 多节点客户端，每个节点一个tcpclient.TCPClient
+// 连接失败/空闲超时的节点标记为不可用，探测恢复后重新加入
+type TCPCluster interface {
+	Name() string
+	Start(header http.Header)
+	Stop()
+	Add(address string) error
+	Remove(address string)
+	Range(cb func(address string, peer conn.Session, healthy bool))
+	Pick(key string) (peer conn.Session, done func(), err error)
+	Call(ctx context.Context, c *rpc.Client, key string, cmd uint32, req any, resp any) error
+	SetBalance(balance Balance)
+	SetResolver(resolver Resolver, d time.Duration)
+	SetProbe(d time.Duration, probe func(peer conn.Session) bool)
+	SetDialTimeout(d time.Duration)
+	SetIdleTimeout(timeout, d time.Duration)
+	SetTLSConfig(config *tls.Config)
+	SetWSOptions(opt *tcp.WSOptions)
+	SetProtocolCallback(cb cb.OnProtocol)
+	SetConnectedCallback(cb cb.OnConnected)
+	SetClosedCallback(cb cb.OnClosed)
+	SetMessageCallback(cb cb.OnMessage)
+	SetHealthCallback(cb func(address string, healthy bool))
+}
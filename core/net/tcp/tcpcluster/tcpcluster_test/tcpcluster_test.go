@@ -0,0 +1,131 @@
+package tcpcluster_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/tcp/tcpcluster"
+	"github.com/cwloo/gonet/core/net/tcp/tcpserver"
+)
+
+var ports = []string{"18960", "18961", "18962"}
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func start(t *testing.T) tcpcluster.TCPCluster {
+	addrs := []string{}
+	for _, port := range ports {
+		srv := tcpserver.NewTCPServer("s"+port, "tcp://127.0.0.1:"+port)
+		go srv.ListenTCP()
+		addrs = append(addrs, "tcp://127.0.0.1:"+port)
+	}
+	time.Sleep(200 * time.Millisecond)
+	c := tcpcluster.NewTCPCluster("c", addrs...)
+	c.SetIdleTimeout(30*time.Second, time.Second)
+	c.Start(nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		n := 0
+		c.Range(func(address string, peer conn.Session, healthy bool) {
+			if healthy {
+				n++
+			}
+		})
+		if n == len(ports) {
+			return c
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("endpoints not healthy")
+	return nil
+}
+
+func pick(t *testing.T, c tcpcluster.TCPCluster, key string) (string, func()) {
+	peer, done, err := c.Pick(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer.RemoteAddr(), done
+}
+
+func TestBalance(t *testing.T) {
+	c := start(t)
+	defer c.Stop()
+
+	//轮询均匀分布
+	c.SetBalance(tcpcluster.KRoundRobin)
+	count := map[string]int{}
+	for i := 0; i < 300; i++ {
+		addr, done := pick(t, c, "")
+		done()
+		count[addr]++
+	}
+	for addr, n := range count {
+		if n != 100 {
+			t.Fatalf("round robin %v %v", addr, n)
+		}
+	}
+
+	//最少在途请求
+	c.SetBalance(tcpcluster.KLeastPending)
+	addrs, dones := []string{}, []func(){}
+	for i := 0; i < len(ports); i++ {
+		addr, done := pick(t, c, "")
+		addrs, dones = append(addrs, addr), append(dones, done)
+	}
+	if addrs[0] == addrs[1] || addrs[1] == addrs[2] || addrs[0] == addrs[2] {
+		t.Fatalf("least pending %v", addrs)
+	}
+	dones[1]()
+	dones[1]()
+	if addr, done := pick(t, c, ""); addr != addrs[1] {
+		t.Fatalf("least pending want %v, got %v", addrs[1], addr)
+	} else {
+		done()
+	}
+	dones[0]()
+	dones[2]()
+
+	//一致性哈希，同一key稳定，分布均匀
+	c.SetBalance(tcpcluster.KConsistentHash)
+	owner := map[string]string{}
+	count = map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		addr, done := pick(t, c, key)
+		done()
+		owner[key] = addr
+		count[addr]++
+	}
+	for addr, n := range count {
+		if n < 250 || n > 420 {
+			t.Fatalf("consistent hash %v %v", addr, n)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if addr, done := pick(t, c, key); addr != owner[key] {
+			t.Fatalf("consistent hash key %v moved %v -> %v", key, owner[key], addr)
+		} else {
+			done()
+		}
+	}
+	//移除节点只影响该节点上的key
+	removed := "127.0.0.1:" + ports[2]
+	c.Remove("tcp://" + removed)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		addr, done := pick(t, c, key)
+		done()
+		switch {
+		case addr == removed:
+			t.Fatalf("removed endpoint picked")
+		case owner[key] != removed && addr != owner[key]:
+			t.Fatalf("consistent hash key %v moved %v -> %v", key, owner[key], addr)
+		}
+	}
+}
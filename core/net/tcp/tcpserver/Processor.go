@@ -1,15 +1,20 @@
 package tcpserver
 
 import (
+	"context"
 	"errors"
 	"net"
+	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/cwloo/gonet/core/base/mq"
 	"github.com/cwloo/gonet/core/cb"
 	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/geoip"
 	"github.com/cwloo/gonet/core/net/keepalive"
 	"github.com/cwloo/gonet/core/net/tcp"
 	"github.com/cwloo/gonet/core/net/transmit"
@@ -26,11 +31,28 @@ type Processor struct {
 	numConnected    int32
 	hold            conn.HoldType
 	peers           conn.Sessions
+	hwm             int
+	policy          mq.Policy
+	batchCount      int
+	batchSize       int
+	complete        conn.CompleteType
+	heartbeat       *tcp.Heartbeat
+	idleTimeout     time.Duration
+	idleSet         bool
+	authTimeout     time.Duration
 	acceptor        tcp.Acceptor
 	onConnected     cb.OnConnected
 	onClosed        cb.OnClosed
 	onMessage       cb.OnMessage
 	onWriteComplete cb.OnWriteComplete
+	onGoodbye       cb.OnGoodbye
+}
+
+// 优雅关闭结果
+type ShutdownReport struct {
+	Total    int //关闭前会话数
+	Graceful int //正常关闭
+	Forced   int //超时强制关闭
 }
 
 func NewTCPServer(name string, address ...string) TCPServer {
@@ -77,6 +99,25 @@ func (s *Processor) SetHoldType(hold conn.HoldType) {
 	s.hold = hold
 }
 
+// 设置会话发送队列高水位及队列满处理策略，size<=0不限制
+// mq.KBlock 无超时，队列满时Write阻塞直到写协程腾出空位
+func (s *Processor) SetHighWaterMark(size int, policy mq.Policy) {
+	s.hwm = size
+	s.policy = policy
+}
+
+// 应用层心跳，nil关闭
+func (s *Processor) SetHeartbeat(hb *tcp.Heartbeat) {
+	s.heartbeat = hb
+}
+
+// 设置会话合并写，count<=0关闭，size<=0不限制批次字节数
+func (s *Processor) SetWriteBatch(count, size int, complete conn.CompleteType) {
+	s.batchCount = count
+	s.batchSize = size
+	s.complete = complete
+}
+
 func (s *Processor) Range(cb func(peer conn.Session)) {
 	if conn.KHold == s.hold {
 		s.peers.Range(cb)
@@ -94,10 +135,13 @@ func (s *Processor) SetHandshakeTimeout(d time.Duration) {
 	s.acceptor.SetHandshakeTimeout(d)
 }
 
+// 会话空闲超时，d为检查间隔，首次调用初始化全局定时轮盘，之后调用的d不生效，沿用首次检查间隔
+// 各服务/客户端可设置不同超时(按秒向上取整)，timeout<=0不检查空闲，会话可再调用conn.Session.SetIdleTimeout修改
 func (s *Processor) SetIdleTimeout(timeout, d time.Duration) {
 	s.assertAcceptor()
 	s.acceptor.SetIdleTimeout(d)
 	keepalive.Init(timeout, d)
+	s.idleTimeout, s.idleSet = timeout, true
 }
 
 func (s *Processor) SetReadBufferSize(readBufferSize int) {
@@ -105,6 +149,90 @@ func (s *Processor) SetReadBufferSize(readBufferSize int) {
 	s.acceptor.SetReadBufferSize(readBufferSize)
 }
 
+// websocket压缩/消息大小/Origin/子协议
+func (s *Processor) SetWSOptions(opt *tcp.WSOptions) {
+	s.assertAcceptor()
+	s.acceptor.SetWSOptions(opt)
+}
+
+// websocket路由，各路由可使用不同channel与回调
+func (s *Processor) HandleRoute(route *tcp.Route) {
+	s.assertAcceptor()
+	s.acceptor.HandleRoute(route)
+}
+
+// 认证期限，连接建立后d内未调用conn.Session.Authenticate关闭连接，d<=0不限制
+func (s *Processor) SetAuthTimeout(d time.Duration) {
+	s.authTimeout = d
+}
+
+// tcp监听同端口接入websocket，按首字节嗅探
+func (s *Processor) SetSniffing(enable bool) {
+	s.assertAcceptor()
+	s.acceptor.SetSniffing(enable)
+}
+
+// 同端口普通HTTP处理
+func (s *Processor) Handle(pattern string, handler http.Handler) {
+	s.assertAcceptor()
+	s.acceptor.Handle(pattern, handler)
+}
+
+// 最大连接数，n<=0不限制
+func (s *Processor) SetMaxConnections(n int) {
+	s.assertAcceptor()
+	s.acceptor.SetMaxConnections(n)
+}
+
+// 单IP最大连接数，n<=0不限制
+func (s *Processor) SetMaxConnectionsPerIP(n int) {
+	s.assertAcceptor()
+	s.acceptor.SetMaxConnectionsPerIP(n)
+}
+
+// 令牌桶接受速率(每秒)及突发数，rate<=0不限制
+func (s *Processor) SetAcceptRate(rate float64, burst int) {
+	s.assertAcceptor()
+	s.acceptor.SetAcceptRate(rate, burst)
+}
+
+// 拒绝接入回调
+func (s *Processor) SetRejectCallback(cb cb.OnReject) {
+	s.assertAcceptor()
+	s.acceptor.SetRejectCallback(cb)
+}
+
+// 地区解析，接入时填充conn.Region，可用geoip.Open打开离线库
+func (s *Processor) SetRegionResolver(r geoip.Resolver) {
+	s.assertAcceptor()
+	s.acceptor.SetRegionResolver(r)
+}
+
+// 启用PROXY protocol v1/v2，conn.Session.RemoteAddr为真实客户端地址
+// 须同时设置SetTrustedProxies，仅信任其中代理发送的头部
+func (s *Processor) SetProxyProtocol(enable bool) {
+	s.assertAcceptor()
+	s.acceptor.SetProxyProtocol(enable)
+}
+
+// unix socket文件权限，0不修改
+func (s *Processor) SetUnixFileMode(mode os.FileMode) {
+	s.assertAcceptor()
+	s.acceptor.SetUnixFileMode(mode)
+}
+
+// 可信代理CIDR列表，用于PROXY protocol及websocket X-Forwarded-For
+func (s *Processor) SetTrustedProxies(cidr ...string) error {
+	s.assertAcceptor()
+	return s.acceptor.SetTrustedProxies(cidr...)
+}
+
+// 拒绝接入计数
+func (s *Processor) Rejected(id conn.RejectID) int64 {
+	s.assertAcceptor()
+	return s.acceptor.Rejected(id)
+}
+
 func (s *Processor) ListenAddr() *conn.Address {
 	s.assertAcceptor()
 	return s.acceptor.Addr()
@@ -115,6 +243,18 @@ func (s *Processor) SetCertFile(certfile, keyfile string) {
 	s.acceptor.SetCertFile(certfile, keyfile)
 }
 
+// 双向认证，OnCondition中peerAddr为*conn.TLSAddr
+func (s *Processor) SetClientCAFile(cafile string, required bool) error {
+	s.assertAcceptor()
+	return s.acceptor.SetClientCAFile(cafile, required)
+}
+
+// 立即重新加载证书，证书文件修改后也会自动加载
+func (s *Processor) ReloadCertificate() error {
+	s.assertAcceptor()
+	return s.acceptor.ReloadCertificate()
+}
+
 func (s *Processor) SetProtocolCallback(cb cb.OnProtocol) {
 	s.assertAcceptor()
 	s.acceptor.SetProtocolCallback(cb)
@@ -146,10 +286,20 @@ func (s *Processor) SetWriteCompleteCallback(cb cb.OnWriteComplete) {
 	s.onWriteComplete = cb
 }
 
+// 优雅关闭时关闭会话前回调，可发送协议层告别消息
+func (s *Processor) SetGoodbyeCallback(cb cb.OnGoodbye) {
+	s.onGoodbye = cb
+}
+
 func (s *Processor) ListenTCP(address ...string) {
 	s.acceptor.ListenTCP(address...)
 }
 
+// 同ListenTCP，地址解析或监听失败时返回错误
+func (s *Processor) Listen(address ...string) error {
+	return s.acceptor.Listen(address...)
+}
+
 func (s *Processor) Stop() {
 	s.acceptor.Stop()
 	if conn.KHold == s.hold {
@@ -157,17 +307,80 @@ func (s *Processor) Stop() {
 	}
 }
 
+// 优雅关闭(需KHold)
+// 停止接受新连接 -> 告别回调 -> 发送完队列数据后关闭会话 -> 超时强制关闭
+func (s *Processor) Shutdown(ctx context.Context) (report ShutdownReport) {
+	if conn.KHold != s.hold {
+		logs.Fatalf("error")
+	}
+	s.acceptor.Stop()
+	peers := []conn.Session{}
+	s.peers.Range(func(peer conn.Session) {
+		peers = append(peers, peer)
+	})
+	report.Total = len(peers)
+	if s.onGoodbye != nil {
+		for _, peer := range peers {
+			if peer.Connected() {
+				s.onGoodbye(peer)
+			}
+		}
+	}
+	//Close排在队列数据之后，写协程发送完再关闭，不再接受新会话
+	s.peers.Stop()
+	if s.peers.Count() > 0 {
+		done := make(chan struct{})
+		go func() {
+			s.peers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+	for _, peer := range peers {
+		if s.peers.Get(peer.ID()) != nil {
+			report.Forced++
+			peer.(*tcp.TCPConnection).ForceClose()
+		}
+	}
+	report.Graceful = report.Total - report.Forced
+	return
+}
+
 func (s *Processor) onCondition(peerAddr net.Addr, peerRegion *conn.Region) bool {
 	return true
 }
 
+// 路由回调，未设置的沿用服务端回调
+func (s *Processor) callbacks(route *tcp.Route) (onConnected cb.OnConnected, onClosed cb.OnClosed, onMessage cb.OnMessage, onWriteComplete cb.OnWriteComplete) {
+	onConnected, onClosed, onMessage, onWriteComplete = s.onConnected, s.onClosed, s.onMessage, s.onWriteComplete
+	if route == nil {
+		return
+	}
+	if route.OnConnected != nil {
+		onConnected = route.OnConnected
+	}
+	if route.OnClosed != nil {
+		onClosed = route.OnClosed
+	}
+	if route.OnMessage != nil {
+		onMessage = route.OnMessage
+	}
+	if route.OnWriteComplete != nil {
+		onWriteComplete = route.OnWriteComplete
+	}
+	return
+}
+
 func (s *Processor) newConnection(c any, channel transmit.Channel, protoName string, peerRegion *conn.Region, v ...any) {
 	switch protoName {
-	case "tcp":
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
 		if p, ok := c.(net.Conn); ok {
 			connID := conn.NewConnID()
 			localAddr := p.LocalAddr().String()
-			peerAddr := p.RemoteAddr().String()
+			peerAddr, proxyAddr := tcp.PeerAddr(c, v...)
 			peer := tcp.NewTCPConnection(
 				connID,
 				strings.Join([]string{s.name, "#", localAddr, "<-", peerAddr, "#", strconv.FormatInt(connID, 10)}, ""),
@@ -182,6 +395,14 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 			peer.(*tcp.TCPConnection).SetErrorCallback(s.onConnectionError)
 			peer.(*tcp.TCPConnection).SetEstablishCallback(s.remove)
 			peer.(*tcp.TCPConnection).SetDestroyCallback(s.reset)
+			peer.(*tcp.TCPConnection).SetHighWaterMark(s.hwm, s.policy)
+			peer.(*tcp.TCPConnection).SetWriteBatch(s.batchCount, s.batchSize, s.complete)
+			peer.(*tcp.TCPConnection).SetHeartbeat(s.heartbeat)
+			if s.idleSet {
+				peer.(*tcp.TCPConnection).SetIdleTimeout(s.idleTimeout)
+			}
+			peer.(*tcp.TCPConnection).SetAuthDeadline(s.authTimeout)
+			peer.(*tcp.TCPConnection).SetProxyAddr(proxyAddr)
 			peer.(*tcp.TCPConnection).ConnectEstablished(v...)
 			// save peer first, otherwise it will be dtcor immediately
 			if conn.KHoldNone != s.hold && !s.peers.Add(peer) {
@@ -194,21 +415,31 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 		if p, ok := c.(*websocket.Conn); ok {
 			connID := conn.NewConnID()
 			localAddr := p.LocalAddr().String()
-			peerAddr := p.RemoteAddr().String()
+			peerAddr, proxyAddr := tcp.PeerAddr(c, v...)
 			peer := tcp.NewTCPConnection(
 				connID,
 				strings.Join([]string{s.name, "#", localAddr, "<-", peerAddr, "#", strconv.FormatInt(connID, 10)}, ""),
 				c,
 				conn.KServer,
 				channel, localAddr, peerAddr, protoName, peerRegion, s.acceptor.GetIdleTimeout())
-			peer.(*tcp.TCPConnection).SetConnectedCallback(s.onConnected)
-			peer.(*tcp.TCPConnection).SetClosedCallback(s.onClosed)
-			peer.(*tcp.TCPConnection).SetMessageCallback(s.onMessage)
-			peer.(*tcp.TCPConnection).SetWriteCompleteCallback(s.onWriteComplete)
+			onConnected, onClosed, onMessage, onWriteComplete := s.callbacks(tcp.RouteOf(v...))
+			peer.(*tcp.TCPConnection).SetConnectedCallback(onConnected)
+			peer.(*tcp.TCPConnection).SetClosedCallback(onClosed)
+			peer.(*tcp.TCPConnection).SetMessageCallback(onMessage)
+			peer.(*tcp.TCPConnection).SetWriteCompleteCallback(onWriteComplete)
 			peer.(*tcp.TCPConnection).SetCloseCallback(s.removeConnection)
 			peer.(*tcp.TCPConnection).SetErrorCallback(s.onConnectionError)
 			peer.(*tcp.TCPConnection).SetEstablishCallback(s.remove)
 			peer.(*tcp.TCPConnection).SetDestroyCallback(s.reset)
+			peer.(*tcp.TCPConnection).SetHighWaterMark(s.hwm, s.policy)
+			peer.(*tcp.TCPConnection).SetWriteBatch(s.batchCount, s.batchSize, s.complete)
+			peer.(*tcp.TCPConnection).SetHeartbeat(s.heartbeat)
+			if s.idleSet {
+				peer.(*tcp.TCPConnection).SetIdleTimeout(s.idleTimeout)
+			}
+			peer.(*tcp.TCPConnection).SetAuthDeadline(s.authTimeout)
+			peer.(*tcp.TCPConnection).SetProxyAddr(proxyAddr)
+			peer.(*tcp.TCPConnection).SetWSState(tcp.WSStateOf(v...))
 			peer.(*tcp.TCPConnection).ConnectEstablished(v...)
 			// save peer first, otherwise it will be dtcor immediately
 			if conn.KHoldNone != s.hold && !s.peers.Add(peer) {
@@ -224,7 +455,7 @@ func (s *Processor) newConnection(c any, channel transmit.Channel, protoName str
 
 func (s *Processor) onProtocol(proto string) transmit.Channel {
 	switch proto {
-	case "tcp":
+	case "tcp", "tls", "tcps", "unix", "udp", "kcp":
 		return tcpchannel.NewChannel()
 	case "ws", "wss":
 		return wschannel.NewChannel()
@@ -260,6 +491,7 @@ func (s *Processor) OnWriteComplete(peer conn.Session) {
 
 func (s *Processor) removeConnection(peer conn.Session) {
 	// s.peers.Remove(peer)
+	s.acceptor.Release(peer.RemoteAddr())
 	peer.(*tcp.TCPConnection).ConnectDestroyed()
 }
 
@@ -1,10 +1,16 @@
 package tcpserver
 
 import (
+	"context"
+	"net/http"
+	"os"
 	"time"
 
+	"github.com/cwloo/gonet/core/base/mq"
 	"github.com/cwloo/gonet/core/cb"
 	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/core/net/geoip"
+	"github.com/cwloo/gonet/core/net/tcp"
 )
 
 // TCP服务端
@@ -13,9 +19,14 @@ type TCPServer interface {
 	Peers() conn.Sessions
 	ListenAddr() *conn.Address
 	ListenTCP(address ...string)
+	Listen(address ...string) error
 	Stop()
+	Shutdown(ctx context.Context) ShutdownReport
 	Range(cb func(peer conn.Session))
 	SetHoldType(holdType conn.HoldType)
+	SetHighWaterMark(size int, policy mq.Policy)
+	SetWriteBatch(count, size int, complete conn.CompleteType)
+	SetHeartbeat(hb *tcp.Heartbeat)
 	SetProtocolCallback(cb cb.OnProtocol)
 	SetVerifyCallback(cb cb.OnVerify)
 	SetConditionCallback(cb cb.OnCondition)
@@ -23,8 +34,25 @@ type TCPServer interface {
 	SetClosedCallback(cb cb.OnClosed)
 	SetMessageCallback(cb cb.OnMessage)
 	SetWriteCompleteCallback(cb cb.OnWriteComplete)
+	SetGoodbyeCallback(cb cb.OnGoodbye)
+	SetRejectCallback(cb cb.OnReject)
+	SetMaxConnections(n int)
+	SetMaxConnectionsPerIP(n int)
+	SetAcceptRate(rate float64, burst int)
+	SetRegionResolver(r geoip.Resolver)
+	SetProxyProtocol(enable bool)
+	SetUnixFileMode(mode os.FileMode)
+	SetTrustedProxies(cidr ...string) error
+	Rejected(id conn.RejectID) int64
 	SetCertFile(certfile, keyfile string)
+	SetClientCAFile(cafile string, required bool) error
+	ReloadCertificate() error
 	SetHandshakeTimeout(d time.Duration)
 	SetIdleTimeout(timeout, d time.Duration)
 	SetReadBufferSize(readBufferSize int)
+	SetWSOptions(opt *tcp.WSOptions)
+	HandleRoute(route *tcp.Route)
+	SetSniffing(enable bool)
+	SetAuthTimeout(d time.Duration)
+	Handle(pattern string, handler http.Handler)
 }
@@ -19,6 +19,12 @@ type Channel interface {
 	OnSend(conn any, msg any, msgType int) error
 }
 
+// 消息编码接口(流协议合并写)
+type Encoder interface {
+	// 消息编码成待发送数据
+	OnEncode(msg any, msgType int) ([]byte, error)
+}
+
 func IsEOFOrReadError(err error) bool {
 	if err == io.EOF {
 		return true
@@ -11,10 +11,16 @@ import (
 
 // TCP协议读写解析
 type Channel struct {
+	codec codec.Codec
 }
 
-func NewChannel() transmit.Channel {
-	return &Channel{}
+// name 编解码器名称，默认gob
+func NewChannel(name ...string) transmit.Channel {
+	return &Channel{codec: codec.GetOrDefault(name...)}
+}
+
+func (s *Channel) Codec() codec.Codec {
+	return s.codec
 }
 
 func (s *Channel) OnRecv(conn any) (int, any, error) {
@@ -36,13 +42,20 @@ func (s *Channel) OnSend(conn any, msg any, msgType int) error {
 	if c == nil {
 		logs.Fatalf("error")
 	}
+	b, err := s.OnEncode(msg, msgType)
+	if err != nil {
+		return err
+	}
+	return WriteFull(c, b)
+}
+
+func (s *Channel) OnEncode(msg any, msgType int) ([]byte, error) {
 	switch msg := msg.(type) {
 	case string:
-		return WriteFull(c, conv.StrToByte(msg))
+		return conv.StrToByte(msg), nil
 	case []byte:
-		return WriteFull(c, msg)
+		return msg, nil
 	default:
-		b, _ := codec.Encode(msg)
-		return WriteFull(c, b)
+		return s.codec.Marshal(msg)
 	}
 }
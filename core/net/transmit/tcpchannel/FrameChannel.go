@@ -0,0 +1,197 @@
+package tcpchannel
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/cwloo/gonet/core/net/transmit"
+	logs "github.com/cwloo/gonet/logs"
+	"github.com/cwloo/gonet/utils/codec"
+	"github.com/cwloo/gonet/utils/conv"
+	"github.com/cwloo/gonet/utils/packet"
+)
+
+// 包头类型
+type HeadType uint8
+
+const (
+	KHeadLen16  HeadType = HeadType(2)               //2字节包长(不含包头)
+	KHeadLen32  HeadType = HeadType(4)               //4字节包长(不含包头)
+	KHeadPacket HeadType = HeadType(packet.HEADERSZ) //packet.Pack 18字节包头(包长含包头)
+)
+
+const (
+	defaultMaxSize = 4 << 20 //缺省单帧上限，避免对端包头指定超大长度
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrFrameInvalid  = errors.New("frame invalid")
+)
+
+// TCP协议读写解析(按包头长度分帧，每次OnRecv返回一个完整帧)
+type FrameChannel struct {
+	head    HeadType
+	order   binary.ByteOrder
+	maxSize int
+	codec   codec.Codec
+}
+
+// maxSize 单帧最大字节数(含包头)，<=0使用缺省上限4MB，超出时读取前即返回ErrFrameTooLarge
+// name 编解码器名称，默认gob
+func NewFrameChannel(head HeadType, order binary.ByteOrder, maxSize int, name ...string) transmit.Channel {
+	switch head {
+	case KHeadLen16, KHeadLen32, KHeadPacket:
+	default:
+		logs.Fatalf("error")
+	}
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	return &FrameChannel{head: head, order: order, maxSize: maxSize, codec: codec.GetOrDefault(name...)}
+}
+
+func (s *FrameChannel) Head() HeadType {
+	return s.head
+}
+
+func (s *FrameChannel) Order() binary.ByteOrder {
+	return s.order
+}
+
+func (s *FrameChannel) MaxSize() int {
+	return s.maxSize
+}
+
+func (s *FrameChannel) Codec() codec.Codec {
+	return s.codec
+}
+
+// 读取一帧
+// KHeadLen16/KHeadLen32 返回去掉包头的数据
+// KHeadPacket 返回含包头的完整帧，可直接packet.Unpack
+func (s *FrameChannel) OnRecv(conn any) (int, any, error) {
+	c, _ := conn.(net.Conn)
+	if c == nil {
+		logs.Fatalf("error")
+	}
+	switch s.head {
+	case KHeadPacket:
+		head := make([]byte, packet.HEADERSZ)
+		err := ReadFull(c, head)
+		if err != nil {
+			return 0, nil, err
+		}
+		size := int(s.order.Uint16(head[0:]))
+		if size < packet.HEADERSZ {
+			return 0, nil, ErrFrameInvalid
+		}
+		if size > s.maxSize {
+			return 0, nil, ErrFrameTooLarge
+		}
+		buf := make([]byte, size)
+		copy(buf, head)
+		if size > packet.HEADERSZ {
+			err = ReadFull(c, buf[packet.HEADERSZ:])
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		return 0, buf, nil
+	default:
+		head := make([]byte, s.head)
+		err := ReadFull(c, head)
+		if err != nil {
+			return 0, nil, err
+		}
+		size := 0
+		switch s.head {
+		case KHeadLen16:
+			size = int(s.order.Uint16(head))
+		case KHeadLen32:
+			size = int(s.order.Uint32(head))
+		}
+		if size < 0 || size > s.maxSize-int(s.head) {
+			return 0, nil, ErrFrameTooLarge
+		}
+		buf := make([]byte, size)
+		if size > 0 {
+			err = ReadFull(c, buf)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		return 0, buf, nil
+	}
+}
+
+// 发送一帧
+// KHeadLen16/KHeadLen32 自动添加包头
+// KHeadPacket []byte/string视为已打包数据，*packet.Msg自动打包
+func (s *FrameChannel) OnSend(conn any, msg any, msgType int) error {
+	c, _ := conn.(net.Conn)
+	if c == nil {
+		logs.Fatalf("error")
+	}
+	b, err := s.Frame(msg)
+	if err != nil {
+		return err
+	}
+	return WriteFull(c, b)
+}
+
+func (s *FrameChannel) OnEncode(msg any, msgType int) ([]byte, error) {
+	return s.Frame(msg)
+}
+
+// 消息打包成帧
+func (s *FrameChannel) Frame(msg any) ([]byte, error) {
+	var data []byte
+	switch msg := msg.(type) {
+	case string:
+		data = conv.StrToByte(msg)
+	case []byte:
+		data = msg
+	case *packet.Msg:
+		if s.head == KHeadPacket {
+			return packet.Pack(msg, s.order)
+		}
+		data = msg.Data
+	default:
+		b, err := s.codec.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+	switch s.head {
+	case KHeadPacket:
+		if len(data) < packet.HEADERSZ {
+			return nil, ErrFrameInvalid
+		}
+		if len(data) > s.maxSize {
+			return nil, ErrFrameTooLarge
+		}
+		return data, nil
+	case KHeadLen16:
+		if len(data) > 0xFFFF || len(data)+int(s.head) > s.maxSize {
+			return nil, ErrFrameTooLarge
+		}
+		b := make([]byte, int(s.head)+len(data))
+		s.order.PutUint16(b, uint16(len(data)))
+		copy(b[s.head:], data)
+		return b, nil
+	default:
+		if uint64(len(data)) > 0xFFFFFFFF || len(data)+int(s.head) > s.maxSize {
+			return nil, ErrFrameTooLarge
+		}
+		b := make([]byte, int(s.head)+len(data))
+		s.order.PutUint32(b, uint32(len(data)))
+		copy(b[s.head:], data)
+		return b, nil
+	}
+}
@@ -0,0 +1,40 @@
+package tcpchannel_test
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/cwloo/gonet/core/net/transmit/tcpchannel"
+)
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	for _, maxSize := range []int{0, 1024} {
+		ch := tcpchannel.NewFrameChannel(tcpchannel.KHeadLen32, binary.LittleEndian, maxSize)
+		c, peer := net.Pipe()
+		//包头声明约4GB，读取包体前即拒绝
+		go peer.Write([]byte{0xff, 0xff, 0xff, 0xff})
+		if _, _, err := ch.OnRecv(c); err != tcpchannel.ErrFrameTooLarge {
+			t.Fatalf("maxSize %v want ErrFrameTooLarge, got %v", maxSize, err)
+		}
+		c.Close()
+		peer.Close()
+	}
+	//上限内正常读取
+	ch := tcpchannel.NewFrameChannel(tcpchannel.KHeadLen32, binary.LittleEndian, 0)
+	b, err := ch.(*tcpchannel.FrameChannel).Frame([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, peer := net.Pipe()
+	defer c.Close()
+	defer peer.Close()
+	go peer.Write(b)
+	if _, msg, err := ch.OnRecv(c); err != nil || string(msg.([]byte)) != "hello" {
+		t.Fatalf("recv %v %v", msg, err)
+	}
+}
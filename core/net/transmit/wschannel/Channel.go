@@ -11,10 +11,16 @@ import (
 
 // websocket协议读写解析
 type Channel struct {
+	codec codec.Codec
 }
 
-func NewChannel() transmit.Channel {
-	return &Channel{}
+// name 编解码器名称，默认gob
+func NewChannel(name ...string) transmit.Channel {
+	return &Channel{codec: codec.GetOrDefault(name...)}
+}
+
+func (s *Channel) Codec() codec.Codec {
+	return s.codec
 }
 
 func (s *Channel) OnRecv(conn any) (int, any, error) {
@@ -61,7 +67,10 @@ func (s *Channel) OnSend(conn any, msg any, msgType int) error {
 		case []byte:
 			return c.WriteMessage(msgType, msg)
 		default:
-			b, _ := codec.Encode(msg)
+			b, err := s.codec.Marshal(msg)
+			if err != nil {
+				return err
+			}
 			return c.WriteMessage(msgType, b)
 		}
 	default:
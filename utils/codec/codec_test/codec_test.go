@@ -0,0 +1,79 @@
+package codec_test
+
+import (
+	"testing"
+
+	"github.com/cwloo/gonet/utils/codec"
+	"github.com/cwloo/gonet/utils/packet"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	Id   int64
+	Name string
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func TestCodec(t *testing.T) {
+	for _, name := range []string{codec.JSON, codec.MSGPACK, codec.GOB} {
+		c := codec.Get(name)
+		if c == nil {
+			t.Fatalf("%v not registered", name)
+		}
+		b, err := c.Marshal(&user{Id: 10001, Name: "gonet"})
+		if err != nil {
+			t.Fatalf("%v %v", name, err)
+		}
+		v := user{}
+		if err := c.Unmarshal(b, &v); err != nil {
+			t.Fatalf("%v %v", name, err)
+		}
+		if v.Id != 10001 || v.Name != "gonet" {
+			t.Fatalf("%v %+v", name, v)
+		}
+	}
+}
+
+func TestProto(t *testing.T) {
+	c := codec.Get(codec.PROTOBUF)
+	b, err := c.Marshal(wrapperspb.String("gonet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &wrapperspb.StringValue{}
+	if err := c.Unmarshal(b, v); err != nil || v.Value != "gonet" {
+		t.Fatal(v, err)
+	}
+	if _, err := c.Marshal(&user{}); err != codec.ErrNotProto {
+		t.Fatal(err)
+	}
+}
+
+func TestEncType(t *testing.T) {
+	for encType, name := range map[uint8]string{
+		packet.ENC_JSON_NONE:     codec.JSON,
+		packet.ENC_PROTOBUF_NONE: codec.PROTOBUF,
+		packet.ENC_MSGPACK_NONE:  codec.MSGPACK,
+		packet.ENC_GOB_NONE:      codec.GOB,
+	} {
+		c := packet.Codec(encType)
+		if c == nil || c.Name() != name {
+			t.Fatalf("%#x %v", encType, c)
+		}
+	}
+	//加密类型不按明文编解码
+	for _, encType := range []uint8{0x0F, packet.ENC_JSON_AES, packet.ENC_PROTOBUF_BIT_MASK, packet.ENC_JSON_RSA} {
+		if packet.Codec(encType) != nil {
+			t.Fatalf("%#x", encType)
+		}
+		if err := packet.Unmarshal(encType, []byte("{}"), &struct{}{}); err != packet.ErrEncType {
+			t.Fatalf("%#x %v", encType, err)
+		}
+		if _, err := packet.NewWith(1, 1, encType, struct{}{}); err != packet.ErrEncType {
+			t.Fatalf("%#x %v", encType, err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/cwloo/gonet/utils/Proto"
+	ugorji "github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrNotProto = errors.New("not proto.Message")
+	mh          = &ugorji.MsgpackHandle{}
+)
+
+// json编解码
+type jsonCodec struct {
+}
+
+func (s *jsonCodec) Name() string {
+	return JSON
+}
+
+func (s *jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (s *jsonCodec) Unmarshal(b []byte, v any) error {
+	return json.Unmarshal(b, v)
+}
+
+// protobuf编解码
+type protoCodec struct {
+}
+
+func (s *protoCodec) Name() string {
+	return PROTOBUF
+}
+
+func (s *protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProto
+	}
+	return Proto.Encode(m)
+}
+
+func (s *protoCodec) Unmarshal(b []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProto
+	}
+	return Proto.Decode(b, m)
+}
+
+// msgpack编解码
+type msgpackCodec struct {
+}
+
+func (s *msgpackCodec) Name() string {
+	return MSGPACK
+}
+
+func (s *msgpackCodec) Marshal(v any) (b []byte, err error) {
+	err = ugorji.NewEncoderBytes(&b, mh).Encode(v)
+	return
+}
+
+func (s *msgpackCodec) Unmarshal(b []byte, v any) error {
+	return ugorji.NewDecoderBytes(b, mh).Decode(v)
+}
+
+// gob编解码
+type gobCodec struct {
+}
+
+func (s *gobCodec) Name() string {
+	return GOB
+}
+
+func (s *gobCodec) Marshal(v any) ([]byte, error) {
+	return Encode(v)
+}
+
+func (s *gobCodec) Unmarshal(b []byte, v any) error {
+	return Decode(b, v)
+}
@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+const (
+	JSON     = "json"
+	PROTOBUF = "protobuf"
+	MSGPACK  = "msgpack"
+	GOB      = "gob"
+)
+
+var (
+	ErrNotFound = errors.New("codec not found")
+	codecs      = map[string]Codec{}
+	l           = &sync.RWMutex{}
+)
+
+// 编解码器
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(b []byte, v any) error
+}
+
+func init() {
+	Register(&jsonCodec{})
+	Register(&protoCodec{})
+	Register(&msgpackCodec{})
+	Register(&gobCodec{})
+}
+
+// 注册编解码器，同名覆盖
+func Register(c Codec) {
+	if c == nil || c.Name() == "" {
+		panic(errors.New("codec.Register error"))
+	}
+	l.Lock()
+	codecs[strings.ToLower(c.Name())] = c
+	l.Unlock()
+}
+
+// 按名称查找编解码器
+func Get(name string) Codec {
+	l.RLock()
+	c := codecs[strings.ToLower(name)]
+	l.RUnlock()
+	return c
+}
+
+// 按名称查找编解码器，未注册返回默认gob
+func GetOrDefault(name ...string) Codec {
+	if len(name) > 0 && name[0] != "" {
+		if c := Get(name[0]); c != nil {
+			return c
+		}
+	}
+	return Get(GOB)
+}
+
+// 已注册编解码器名称
+func Names() (names []string) {
+	l.RLock()
+	for name := range codecs {
+		names = append(names, name)
+	}
+	l.RUnlock()
+	return
+}
+
+// 按名称编码
+func Marshal(name string, v any) ([]byte, error) {
+	c := Get(name)
+	if c == nil {
+		return nil, ErrNotFound
+	}
+	return c.Marshal(v)
+}
+
+// 按名称解码
+func Unmarshal(name string, b []byte, v any) error {
+	c := Get(name)
+	if c == nil {
+		return ErrNotFound
+	}
+	return c.Unmarshal(b, v)
+}
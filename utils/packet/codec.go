@@ -0,0 +1,79 @@
+package packet
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cwloo/gonet/utils/codec"
+)
+
+const (
+	ENC_MSGPACK_NONE uint8 = 0x03
+	ENC_GOB_NONE     uint8 = 0x04
+)
+
+var (
+	ErrEncType = errors.New("unsupported enc type")
+)
+
+var (
+	encTypes = map[uint8]string{
+		ENC_JSON_NONE:     codec.JSON,
+		ENC_PROTOBUF_NONE: codec.PROTOBUF,
+		ENC_MSGPACK_NONE:  codec.MSGPACK,
+		ENC_GOB_NONE:      codec.GOB,
+	}
+	l = &sync.RWMutex{}
+)
+
+// 加密类型映射编解码器名称，按完整加密类型匹配
+// 高4位为加密方式(BIT_MASK/RSA/AES)，须注册能解密的编解码器，未注册的加密类型拒绝编解码
+func RegisterEncType(encType uint8, name string) {
+	l.Lock()
+	encTypes[encType] = name
+	l.Unlock()
+}
+
+// 加密类型对应的编解码器，未注册返回nil
+func Codec(encType uint8) codec.Codec {
+	l.RLock()
+	name, ok := encTypes[encType]
+	l.RUnlock()
+	if !ok {
+		return nil
+	}
+	return codec.Get(name)
+}
+
+// 按加密类型编码消息
+func NewWith(mainID uint8, subID uint8, encType uint8, v any) (*Msg, error) {
+	c := Codec(encType)
+	if c == nil {
+		return nil, ErrEncType
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Msg{
+		ver:     0x0001,
+		sign:    0x5F5F,
+		encType: encType,
+		mainID:  mainID,
+		subID:   subID,
+		Data:    b,
+	}, nil
+}
+
+func (s *Msg) EncType() uint8 {
+	return s.encType
+}
+
+// 按加密类型解码消息
+func Unmarshal(encType uint8, b []byte, v any) error {
+	c := Codec(encType)
+	if c == nil {
+		return ErrEncType
+	}
+	return c.Unmarshal(b, v)
+}
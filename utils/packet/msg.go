@@ -8,6 +8,7 @@ type Msg struct {
 	encType uint8
 	mainID  uint8
 	subID   uint8
+	reqID   uint32
 	Data    []byte
 }
 
@@ -26,6 +27,27 @@ func New(mainID uint8, subID uint8, v proto.Message) *Msg {
 	}
 }
 
+func (s *Msg) MainID() uint8 {
+	return s.mainID
+}
+
+func (s *Msg) SubID() uint8 {
+	return s.subID
+}
+
+func (s *Msg) ReqID() uint32 {
+	return s.reqID
+}
+
+// 请求ID，请求/响应关联，0表示无需响应
+func (s *Msg) SetReqID(reqID uint32) {
+	s.reqID = reqID
+}
+
+func (s *Msg) Cmd() uint32 {
+	return uint32(Enword(int(s.mainID), int(s.subID)))
+}
+
 func Enword(mainID, subID int) int {
 	return ((0xFF & mainID) << 8) | (0xFF & subID)
 }
@@ -9,6 +9,7 @@ const (
 	SESSIONSZ = 32
 	AESKEYSZ  = 16
 	SERVIDSZ  = 50
+	HEADERSZ  = 18 //包头长度
 )
 
 const (
@@ -50,7 +51,7 @@ const (
 
 func Pack(msg *Msg, order binary.ByteOrder) ([]byte, error) {
 	//len，2字节
-	length := 18 + len(msg.Data)
+	length := HEADERSZ + len(msg.Data)
 	b := make([]byte, length)
 	order.PutUint16(b[0:], uint16(length))
 	//版本0x0001
@@ -66,11 +67,11 @@ func Pack(msg *Msg, order binary.ByteOrder) ([]byte, error) {
 	//预留字段
 	b[11] = byte(0x01)
 	//请求ID
-	order.PutUint32(b[12:], uint32(0))
+	order.PutUint32(b[12:], msg.reqID)
 	//实际大小(json/protobuf)
 	order.PutUint16(b[16:], uint16(len(msg.Data)))
 	//实际数据(json/protobuf)
-	copy(b[18:], msg.Data)
+	copy(b[HEADERSZ:], msg.Data)
 	//CRC，2字节
 	crc := GetChecksum(b[4:])
 	order.PutUint16(b[2:], crc)
@@ -78,38 +79,57 @@ func Pack(msg *Msg, order binary.ByteOrder) ([]byte, error) {
 }
 
 func Unpack(b []byte, order binary.ByteOrder) (uint32, []byte, error) {
+	msg, err := UnpackMsg(b, order)
+	if err != nil {
+		return 0, nil, err
+	}
+	return msg.Cmd(), msg.Data, nil
+}
+
+// 解析完整消息(包头+数据)
+func UnpackMsg(b []byte, order binary.ByteOrder) (*Msg, error) {
+	if len(b) < HEADERSZ {
+		return nil, errors.New("parse error")
+	}
 	//len，2字节
 	length := order.Uint16(b[:2])
 	if length != uint16(len(b)) {
-		return 0, nil, errors.New("parse error")
+		return nil, errors.New("parse error")
 	}
 	//CRC，2字节
 	chsum := order.Uint16(b[2:])
 	//CRC校验
 	crc := GetChecksum(b[4:])
 	if crc != chsum {
-		return 0, nil, errors.New("checksum error")
+		return nil, errors.New("checksum error")
 	}
-	// //版本0x0001
-	// ver := order.Uint16(b[4:])
-	// //标记0x5F5F
-	// sign := order.Uint16(b[6:])
+	//版本0x0001
+	ver := order.Uint16(b[4:])
+	//标记0x5F5F
+	sign := order.Uint16(b[6:])
 	//主命令ID
 	mainID := uint8(b[8])
 	//子命令ID
 	subID := uint8(b[9])
-	// //加密类型
-	// encType := uint8(b[10])
+	//加密类型
+	encType := uint8(b[10])
 	// //预留字段
 	// reserved := uint8(b[11])
-	// //请求ID
-	// reqID := order.Uint32(b[12:16])
+	//请求ID
+	reqID := order.Uint32(b[12:16])
 	// //实际大小(json/protobuf)
 	// realSize := order.Uint16(b[16:18])
 	// logs.Debugf("ver:%#x\nsign:%#x\nmainID:%d\nsubID:%d\nencTy:%#x\nreserv:%d\nreqID:%d\nrealSize:%d",
 	// 	ver, sign, mainID, subID, encType, reserved, reqID, realSize)
 	// 实际数据(json/protobuf)
-	data := b[18:]
-	cmd := uint32(Enword(int(mainID), int(subID)))
-	return cmd, data, nil
+	data := b[HEADERSZ:]
+	return &Msg{
+		ver:     ver,
+		sign:    sign,
+		encType: encType,
+		mainID:  mainID,
+		subID:   subID,
+		reqID:   reqID,
+		Data:    data,
+	}, nil
 }
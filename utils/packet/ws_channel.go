@@ -12,10 +12,16 @@ import (
 
 // websocket协议读写解析
 type WSChannel struct {
+	codec codec.Codec
 }
 
-func NewWSChannel() transmit.Channel {
-	return &WSChannel{}
+// name 编解码器名称，默认gob
+func NewWSChannel(name ...string) transmit.Channel {
+	return &WSChannel{codec: codec.GetOrDefault(name...)}
+}
+
+func (s *WSChannel) Codec() codec.Codec {
+	return s.codec
 }
 
 func (s *WSChannel) OnRecv(conn any) (int, any, error) {
@@ -66,7 +72,10 @@ func (s *WSChannel) OnSend(conn any, msg any, msgType int) error {
 			b, _ := Pack(msg, binary.LittleEndian)
 			return c.WriteMessage(msgType, b)
 		default:
-			b, _ := codec.Encode(msg)
+			b, err := s.codec.Marshal(msg)
+			if err != nil {
+				return err
+			}
 			return c.WriteMessage(msgType, b)
 		}
 	default:
@@ -12,6 +12,7 @@ type TimerWheel interface {
 	PopBucket(interval int32) (v []any)
 	PushBucket(val any, timeout int32) int32
 	UpdateBucket(val any, cursor int32, timeout int32) int32
+	RemoveBucket(val any)
 }
 
 type timerWheel struct {
@@ -75,6 +76,14 @@ func (s *timerWheel) UpdateBucket(val any, cursor int32, timeout int32) int32 {
 	return int32(s.ring.End())
 }
 
+// 移出轮盘，不再超时检查
+func (s *timerWheel) RemoveBucket(val any) {
+	s.assertThisThread()
+	s.ring.Range(func(bucket *bucket.Bucket) bool {
+		return bucket.Remove(val)
+	})
+}
+
 func (s *timerWheel) this() bool {
 	return gid.Getgid() == s.tid
 }
@@ -0,0 +1,393 @@
+package user_session
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cwloo/gonet/core/cb"
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/logs"
+)
+
+var (
+	ErrNoIdentity = errors.New("session not authenticated")
+	ErrClosed     = errors.New("session closed")
+	ErrKicked     = errors.New("session kicked")
+	ErrLoggedIn   = errors.New("already logged in")
+	ErrNotLogin   = errors.New("session not logged in")
+
+	kickKey = conn.NewKey[*KickReason]("user_session.kick")
+)
+
+// 多端登录策略
+type Policy uint8
+
+const (
+	KMultiLogin     Policy = Policy(0) //不限制
+	KOnePerPlatform Policy = Policy(1) //每用户每平台一个会话，新登录踢掉旧会话
+	KOnePerUser     Policy = Policy(2) //每用户一个会话，新登录踢掉所有平台旧会话
+	KKickOldest     Policy = Policy(3) //每用户每平台最多max个会话，超出踢掉最早登录的
+	KRejectNew      Policy = Policy(4) //每用户每平台最多max个会话，超出拒绝新登录
+)
+
+// 踢下线原因
+type KickReason struct {
+	Code int
+	Msg  string
+}
+
+var (
+	EKickReplaced = KickReason{1, "login on another device"}
+	EKickPlatform = KickReason{2, "login on another platform"}
+	EKickOverflow = KickReason{3, "too many sessions"}
+	EKickAdmin    = KickReason{4, "kicked by server"}
+)
+
+// 被踢会话的原因，OnClosed中区分
+func KickReasonOf(peer conn.Session) (reason KickReason, ok bool) {
+	if p, _ := kickKey.Get(peer); p != nil {
+		return *p, true
+	}
+	return
+}
+
+// 会话注册表，按用户/平台/分组索引已认证会话
+// 登录按加锁顺序排列，并发登录以后获得锁的为新登录，旧会话按策略踢下线
+type Registry interface {
+	Login(peer conn.Session) (kicked []conn.Session, err error)
+	Logout(peer conn.Session) bool
+	Kick(peer conn.Session, reason KickReason) bool
+	WrapClosed(next cb.OnClosed) cb.OnClosed
+	Get(userId string, platformId int) []conn.Session
+	GetUser(userId string) []conn.Session
+	GetByIdentity(identity *conn.Identity) conn.Session
+	Join(peer conn.Session, group string) error
+	Leave(peer conn.Session, group string)
+	Group(group string) []conn.Session
+	Broadcast(group string, msg any)
+	Len() int
+	Users() int
+	SetPolicy(policy Policy, max int)
+	SetKickCallback(cb func(peer conn.Session, reason KickReason))
+	SetKickDelay(d time.Duration)
+}
+
+type entry struct {
+	peer     conn.Session
+	identity *conn.Identity
+	groups   map[string]bool
+}
+
+type registry struct {
+	l      *sync.Mutex
+	users  map[string]map[int][]*entry //按登录顺序排列
+	peers  map[int64]*entry
+	groups map[string]map[int64]*entry
+	policy Policy
+	max    int
+	delay  time.Duration
+	onKick func(peer conn.Session, reason KickReason)
+}
+
+func NewRegistry(policy Policy) Registry {
+	return &registry{
+		l:      &sync.Mutex{},
+		users:  map[string]map[int][]*entry{},
+		peers:  map[int64]*entry{},
+		groups: map[string]map[int64]*entry{},
+		policy: policy,
+		max:    1,
+		delay:  time.Second,
+	}
+}
+
+// max为KKickOldest/KRejectNew每平台会话上限，<=0按1处理
+func (s *registry) SetPolicy(policy Policy, max int) {
+	if max <= 0 {
+		max = 1
+	}
+	s.l.Lock()
+	s.policy, s.max = policy, max
+	s.l.Unlock()
+}
+
+// 踢下线前回调，用于向被踢会话发送通知
+func (s *registry) SetKickCallback(cb func(peer conn.Session, reason KickReason)) {
+	s.l.Lock()
+	s.onKick = cb
+	s.l.Unlock()
+}
+
+// 踢下线通知后延迟关闭，确保通知发出
+func (s *registry) SetKickDelay(d time.Duration) {
+	s.l.Lock()
+	s.delay = d
+	s.l.Unlock()
+}
+
+// 按peer.Identity()登记，按策略踢掉旧会话，返回被踢会话
+// 同一会话重复登录幂等，更换身份时先移除旧身份
+func (s *registry) Login(peer conn.Session) (kicked []conn.Session, err error) {
+	identity := peer.Identity()
+	if identity == nil {
+		return nil, ErrNoIdentity
+	}
+	var victims []*entry
+	var reasons []KickReason
+	s.l.Lock()
+	//已关闭会话不再登记，避免OnClosed清理后残留
+	if !peer.Connected() {
+		s.l.Unlock()
+		return nil, ErrClosed
+	}
+	if _, ok := KickReasonOf(peer); ok {
+		s.l.Unlock()
+		return nil, ErrKicked
+	}
+	old, ok := s.peers[peer.ID()]
+	if ok && same(old.identity, identity) {
+		s.l.Unlock()
+		return nil, nil
+	}
+	//先检查是否拒绝，拒绝时保留旧身份登记
+	if s.policy == KRejectNew {
+		n := len(s.users[identity.UserId][identity.PlatformId])
+		if ok && old.identity.UserId == identity.UserId && old.identity.PlatformId == identity.PlatformId {
+			n--
+		}
+		if n >= s.max {
+			s.l.Unlock()
+			return nil, ErrLoggedIn
+		}
+	}
+	if ok {
+		s.remove(old)
+	}
+	platforms := s.users[identity.UserId]
+	switch s.policy {
+	case KOnePerPlatform:
+		for _, e := range platforms[identity.PlatformId] {
+			victims, reasons = append(victims, e), append(reasons, EKickReplaced)
+		}
+	case KOnePerUser:
+		for platformId, entries := range platforms {
+			reason := EKickPlatform
+			if platformId == identity.PlatformId {
+				reason = EKickReplaced
+			}
+			for _, e := range entries {
+				victims, reasons = append(victims, e), append(reasons, reason)
+			}
+		}
+	case KKickOldest:
+		entries := platforms[identity.PlatformId]
+		for i := 0; i < len(entries)-s.max+1; i++ {
+			victims, reasons = append(victims, entries[i]), append(reasons, EKickOverflow)
+		}
+	}
+	for i, e := range victims {
+		s.remove(e)
+		kickKey.Set(e.peer, &reasons[i])
+	}
+	s.add(peer, identity)
+	s.l.Unlock()
+	for i, e := range victims {
+		s.kick(e.peer, reasons[i])
+		kicked = append(kicked, e.peer)
+	}
+	return
+}
+
+// 移除登记，仅移除peer本身
+func (s *registry) Logout(peer conn.Session) (ok bool) {
+	s.l.Lock()
+	e, ok := s.peers[peer.ID()]
+	if ok && e.peer == peer {
+		s.remove(e)
+	} else {
+		ok = false
+	}
+	s.l.Unlock()
+	return
+}
+
+// 主动踢下线
+func (s *registry) Kick(peer conn.Session, reason KickReason) bool {
+	s.l.Lock()
+	e, ok := s.peers[peer.ID()]
+	if !ok || e.peer != peer {
+		s.l.Unlock()
+		return false
+	}
+	s.remove(e)
+	kickKey.Set(peer, &reason)
+	s.l.Unlock()
+	s.kick(peer, reason)
+	return true
+}
+
+func (s *registry) kick(peer conn.Session, reason KickReason) {
+	identity := peer.Identity()
+	logs.Warnf("%v userId=%v platformId=%v %v", peer.Name(), identity.UserId, identity.PlatformId, reason.Msg)
+	s.l.Lock()
+	onKick, delay := s.onKick, s.delay
+	s.l.Unlock()
+	if onKick != nil {
+		onKick(peer, reason)
+	}
+	peer.CloseAfter(delay)
+}
+
+// 会话关闭时自动移除登记，next为业务OnClosed
+func (s *registry) WrapClosed(next cb.OnClosed) cb.OnClosed {
+	return func(peer conn.Session, reason conn.Reason, v ...any) {
+		s.Logout(peer)
+		if next != nil {
+			next(peer, reason, v...)
+		}
+	}
+}
+
+func (s *registry) add(peer conn.Session, identity *conn.Identity) {
+	e := &entry{peer: peer, identity: identity, groups: map[string]bool{}}
+	platforms, ok := s.users[identity.UserId]
+	if !ok {
+		platforms = map[int][]*entry{}
+		s.users[identity.UserId] = platforms
+	}
+	platforms[identity.PlatformId] = append(platforms[identity.PlatformId], e)
+	s.peers[peer.ID()] = e
+}
+
+func same(a, b *conn.Identity) bool {
+	return a.UserId == b.UserId && a.PlatformId == b.PlatformId && a.Session == b.Session
+}
+
+func (s *registry) remove(e *entry) {
+	delete(s.peers, e.peer.ID())
+	for group := range e.groups {
+		if members, ok := s.groups[group]; ok {
+			delete(members, e.peer.ID())
+			if len(members) == 0 {
+				delete(s.groups, group)
+			}
+		}
+	}
+	platforms := s.users[e.identity.UserId]
+	entries := platforms[e.identity.PlatformId]
+	for i, c := range entries {
+		if c == e {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	switch len(entries) {
+	case 0:
+		delete(platforms, e.identity.PlatformId)
+		if len(platforms) == 0 {
+			delete(s.users, e.identity.UserId)
+		}
+	default:
+		platforms[e.identity.PlatformId] = entries
+	}
+}
+
+func (s *registry) Get(userId string, platformId int) (peers []conn.Session) {
+	s.l.Lock()
+	for _, e := range s.users[userId][platformId] {
+		peers = append(peers, e.peer)
+	}
+	s.l.Unlock()
+	return
+}
+
+func (s *registry) GetUser(userId string) (peers []conn.Session) {
+	s.l.Lock()
+	for _, entries := range s.users[userId] {
+		for _, e := range entries {
+			peers = append(peers, e.peer)
+		}
+	}
+	s.l.Unlock()
+	return
+}
+
+func (s *registry) GetByIdentity(identity *conn.Identity) (peer conn.Session) {
+	if identity == nil {
+		return
+	}
+	s.l.Lock()
+	for _, e := range s.users[identity.UserId][identity.PlatformId] {
+		if e.identity.Session == identity.Session {
+			peer = e.peer
+			break
+		}
+	}
+	s.l.Unlock()
+	return
+}
+
+// 加入分组，须已登录，关闭/踢下线时自动退出
+func (s *registry) Join(peer conn.Session, group string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	e, ok := s.peers[peer.ID()]
+	if !ok || e.peer != peer {
+		return ErrNotLogin
+	}
+	members, ok := s.groups[group]
+	if !ok {
+		members = map[int64]*entry{}
+		s.groups[group] = members
+	}
+	members[peer.ID()] = e
+	e.groups[group] = true
+	return nil
+}
+
+func (s *registry) Leave(peer conn.Session, group string) {
+	s.l.Lock()
+	if e, ok := s.peers[peer.ID()]; ok && e.peer == peer {
+		delete(e.groups, group)
+		if members, ok := s.groups[group]; ok {
+			delete(members, peer.ID())
+			if len(members) == 0 {
+				delete(s.groups, group)
+			}
+		}
+	}
+	s.l.Unlock()
+}
+
+func (s *registry) Group(group string) (peers []conn.Session) {
+	s.l.Lock()
+	for _, e := range s.groups[group] {
+		peers = append(peers, e.peer)
+	}
+	s.l.Unlock()
+	return
+}
+
+// 分组广播
+func (s *registry) Broadcast(group string, msg any) {
+	for _, peer := range s.Group(group) {
+		peer.Write(msg)
+	}
+}
+
+// 已登录会话数
+func (s *registry) Len() (n int) {
+	s.l.Lock()
+	n = len(s.peers)
+	s.l.Unlock()
+	return
+}
+
+// 在线用户数
+func (s *registry) Users() (n int) {
+	s.l.Lock()
+	n = len(s.users)
+	s.l.Unlock()
+	return
+}
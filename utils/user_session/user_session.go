@@ -7,7 +7,6 @@ import (
 	"github.com/cwloo/gonet/logs"
 )
 
-
 // [session]=conn
 type SessionToConn struct {
 	l *sync.RWMutex
@@ -92,7 +91,6 @@ func (s *SessionToConn) Range(cb func(string, conn.Session)) {
 	s.l.RUnlock()
 }
 
-
 // [platformid][session]=conn
 type PlatformToSessions struct {
 	l *sync.RWMutex
@@ -177,7 +175,6 @@ func (s *PlatformToSessions) Range(cb func(int, *SessionToConn)) {
 	s.l.RUnlock()
 }
 
-
 // [userid][platformid][session]=conn
 type UserToPlatforms struct {
 	l *sync.RWMutex
@@ -359,6 +356,84 @@ func (s *UserToPlatforms) GetUserConn(userId string, platformId int, sessionId s
 	return
 }
 
+// 按认证身份登记，同身份已登记时替换并返回旧会话
+func (s *UserToPlatforms) AddIdentity(peer conn.Session) (old conn.Session) {
+	identity := peer.Identity()
+	if identity == nil {
+		panic("error")
+	}
+	s.l.Lock()
+	platforms, ok := s.m[identity.UserId]
+	if !ok {
+		platforms = NewPlatformToSessions()
+		s.m[identity.UserId] = platforms
+	}
+	platforms.l.Lock()
+	sessions, ok := platforms.m[identity.PlatformId]
+	if !ok {
+		sessions = NewSessionToConn()
+		platforms.m[identity.PlatformId] = sessions
+	}
+	platforms.l.Unlock()
+	old = sessions.Add(identity.Session, peer)
+	s.l.Unlock()
+	return
+}
+
+// 按认证身份移除，仅当登记的是peer本身，避免移除同身份新登录的会话
+func (s *UserToPlatforms) DelIdentity(peer conn.Session) (ok bool) {
+	identity := peer.Identity()
+	if identity == nil {
+		return
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	platforms, exist := s.m[identity.UserId]
+	if !exist {
+		return
+	}
+	platforms.l.Lock()
+	defer platforms.l.Unlock()
+	sessions, exist := platforms.m[identity.PlatformId]
+	if !exist {
+		return
+	}
+	sessions.l.Lock()
+	if c, exist := sessions.m[identity.Session]; exist && c == peer {
+		delete(sessions.m, identity.Session)
+		ok = true
+	}
+	n := len(sessions.m)
+	sessions.l.Unlock()
+	if n == 0 {
+		delete(platforms.m, identity.PlatformId)
+		if len(platforms.m) == 0 {
+			delete(s.m, identity.UserId)
+		}
+	}
+	return
+}
+
+// 按认证身份查找
+func (s *UserToPlatforms) GetByIdentity(identity *conn.Identity) (peer conn.Session) {
+	if identity == nil {
+		return
+	}
+	return s.GetUserConn(identity.UserId, identity.PlatformId, identity.Session)
+}
+
+// 用户全部平台的会话
+func (s *UserToPlatforms) GetUserSessions(userId string) (peers []conn.Session) {
+	if platforms := s.Get(userId); platforms != nil {
+		platforms.Range(func(_ int, sessions *SessionToConn) {
+			sessions.Range(func(_ string, peer conn.Session) {
+				peers = append(peers, peer)
+			})
+		})
+	}
+	return
+}
+
 // func (s *UserToPlatforms) PrintUserConn(name string) {
 // 	logs.Infof("-------------------------------%v-------------------------------", name)
 // 	s.Range(func(userId string, platforms *PlatformToSessions) {
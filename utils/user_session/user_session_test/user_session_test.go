@@ -0,0 +1,288 @@
+package user_session_test
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cwloo/gonet/core/net/conn"
+	"github.com/cwloo/gonet/utils/user_session"
+)
+
+var ids int64
+
+type session struct {
+	conn.Session
+	id       int64
+	identity *conn.Identity
+	closed   atomic.Bool
+	kicked   atomic.Int32
+	l        sync.Mutex
+	ctx      map[any]any
+}
+
+func newSession(userId string, platformId int) *session {
+	id := atomic.AddInt64(&ids, 1)
+	return &session{
+		id:       id,
+		identity: conn.NewIdentity(userId, platformId, strconv.FormatInt(id, 10)),
+		ctx:      map[any]any{},
+	}
+}
+
+func (s *session) ID() int64 {
+	return s.id
+}
+
+func (s *session) Name() string {
+	return "session#" + strconv.FormatInt(s.id, 10)
+}
+
+func (s *session) Connected() bool {
+	return !s.closed.Load()
+}
+
+func (s *session) Identity() *conn.Identity {
+	return s.identity
+}
+
+func (s *session) SetContextLocker(key any, val any) (old any) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	old = s.ctx[key]
+	s.ctx[key] = val
+	return
+}
+
+func (s *session) GetContextLocker(key any) any {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.ctx[key]
+}
+
+func (s *session) CloseAfter(d time.Duration) {
+	s.kicked.Add(1)
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+}
+
+func reasonOf(t *testing.T, peer *session) user_session.KickReason {
+	reason, ok := user_session.KickReasonOf(peer)
+	if !ok {
+		t.Fatalf("%v not kicked", peer.Name())
+	}
+	if peer.kicked.Load() != 1 {
+		t.Fatalf("%v closed %v times", peer.Name(), peer.kicked.Load())
+	}
+	return reason
+}
+
+func login(t *testing.T, r user_session.Registry, peer *session) []conn.Session {
+	kicked, err := r.Login(peer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kicked
+}
+
+func TestOnePerPlatform(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KOnePerPlatform)
+	a, b, c := newSession("u", 1), newSession("u", 2), newSession("u", 1)
+	login(t, r, a)
+	login(t, r, b)
+	//同平台新登录踢掉旧会话，其它平台不受影响
+	if kicked := login(t, r, c); len(kicked) != 1 || kicked[0] != a {
+		t.Fatalf("kicked %v", kicked)
+	}
+	if reason := reasonOf(t, a); reason != user_session.EKickReplaced {
+		t.Fatalf("reason %v", reason)
+	}
+	if r.Len() != 2 || r.Users() != 1 || len(r.Get("u", 1)) != 1 || r.Get("u", 1)[0] != c {
+		t.Fatalf("len %v users %v", r.Len(), r.Users())
+	}
+	//被踢会话不可再登录
+	if _, err := r.Login(a); err != user_session.ErrKicked {
+		t.Fatalf("want ErrKicked, got %v", err)
+	}
+}
+
+func TestOnePerUser(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KOnePerUser)
+	a, b, c := newSession("u", 1), newSession("u", 2), newSession("u", 1)
+	login(t, r, a)
+	if kicked := login(t, r, b); len(kicked) != 1 || kicked[0] != a {
+		t.Fatalf("kicked %v", kicked)
+	}
+	if reason := reasonOf(t, a); reason != user_session.EKickPlatform {
+		t.Fatalf("reason %v", reason)
+	}
+	if kicked := login(t, r, c); len(kicked) != 1 || kicked[0] != b {
+		t.Fatalf("kicked %v", kicked)
+	}
+	if reason := reasonOf(t, b); reason != user_session.EKickPlatform {
+		t.Fatalf("reason %v", reason)
+	}
+	d := newSession("u", 1)
+	login(t, r, d)
+	if reason := reasonOf(t, c); reason != user_session.EKickReplaced {
+		t.Fatalf("reason %v", reason)
+	}
+	//其它用户不受影响
+	login(t, r, newSession("v", 1))
+	if r.Len() != 2 || r.Users() != 2 || len(r.GetUser("u")) != 1 || r.GetUser("u")[0] != d {
+		t.Fatalf("len %v users %v", r.Len(), r.Users())
+	}
+}
+
+func TestKickOldest(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KKickOldest)
+	r.SetPolicy(user_session.KKickOldest, 3)
+	peers := []*session{}
+	for i := 0; i < 5; i++ {
+		peer := newSession("u", 1)
+		kicked := login(t, r, peer)
+		peers = append(peers, peer)
+		//超出上限时踢掉最早登录的
+		if i < 3 && len(kicked) != 0 || i >= 3 && (len(kicked) != 1 || kicked[0] != peers[i-3]) {
+			t.Fatalf("login %v kicked %v", i, kicked)
+		}
+	}
+	for _, peer := range peers[:2] {
+		if reason := reasonOf(t, peer); reason != user_session.EKickOverflow {
+			t.Fatalf("reason %v", reason)
+		}
+	}
+	got := r.Get("u", 1)
+	if len(got) != 3 {
+		t.Fatalf("sessions %v", len(got))
+	}
+	for i, peer := range got {
+		if peer != peers[i+2] {
+			t.Fatalf("session %v want %v, got %v", i, peers[i+2].Name(), peer.Name())
+		}
+	}
+}
+
+func TestRejectNew(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KRejectNew)
+	r.SetPolicy(user_session.KRejectNew, 2)
+	a, b := newSession("u", 1), newSession("u", 1)
+	login(t, r, a)
+	login(t, r, b)
+	c := newSession("u", 1)
+	if _, err := r.Login(c); err != user_session.ErrLoggedIn {
+		t.Fatalf("want ErrLoggedIn, got %v", err)
+	}
+	//其它平台不受影响
+	login(t, r, newSession("u", 2))
+	//旧会话退出后可登录
+	if !r.Logout(a) {
+		t.Fatal("logout")
+	}
+	login(t, r, c)
+	if r.Len() != 3 || a.kicked.Load() != 0 || b.kicked.Load() != 0 {
+		t.Fatalf("len %v", r.Len())
+	}
+	//更换身份被拒绝时保留旧身份登记
+	d := newSession("v", 1)
+	login(t, r, d)
+	d.identity = conn.NewIdentity("u", 1, "d")
+	if _, err := r.Login(d); err != user_session.ErrLoggedIn {
+		t.Fatalf("want ErrLoggedIn, got %v", err)
+	}
+	if got := r.Get("v", 1); len(got) != 1 || got[0] != d {
+		t.Fatalf("old identity %v", got)
+	}
+	//同平台内更换身份不计自身
+	b.identity = conn.NewIdentity("u", 1, "b2")
+	if _, err := r.Login(b); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 4 || r.GetByIdentity(b.identity) != b {
+		t.Fatalf("len %v", r.Len())
+	}
+}
+
+func TestConcurrentLogin(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KOnePerPlatform)
+	peers := make([]*session, 100)
+	for i := range peers {
+		peers[i] = newSession("u", 1)
+	}
+	var wg sync.WaitGroup
+	var kicked atomic.Int32
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer *session) {
+			defer wg.Done()
+			v, err := r.Login(peer)
+			if err != nil {
+				t.Error(err)
+			}
+			kicked.Add(int32(len(v)))
+		}(peer)
+	}
+	wg.Wait()
+	//最终只保留一个会话，其余均被踢且只踢一次
+	got := r.Get("u", 1)
+	if r.Len() != 1 || len(got) != 1 || kicked.Load() != int32(len(peers)-1) {
+		t.Fatalf("len %v kicked %v", r.Len(), kicked.Load())
+	}
+	for _, peer := range peers {
+		if peer == got[0] {
+			if _, ok := user_session.KickReasonOf(peer); ok || peer.kicked.Load() != 0 {
+				t.Fatalf("%v online but kicked", peer.Name())
+			}
+			continue
+		}
+		reasonOf(t, peer)
+	}
+}
+
+func TestLoginClosed(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KMultiLogin)
+	peer := newSession("u", 1)
+	peer.closed.Store(true)
+	if _, err := r.Login(peer); err != user_session.ErrClosed {
+		t.Fatalf("want ErrClosed, got %v", err)
+	}
+	if r.Len() != 0 || r.Users() != 0 {
+		t.Fatalf("len %v users %v", r.Len(), r.Users())
+	}
+}
+
+func TestWrapClosed(t *testing.T) {
+	r := user_session.NewRegistry(user_session.KMultiLogin)
+	a, b := newSession("u", 1), newSession("u", 1)
+	login(t, r, a)
+	login(t, r, b)
+	for _, peer := range []*session{a, b} {
+		if err := r.Join(peer, "room"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Join(a, "hall"); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	onClosed := r.WrapClosed(func(peer conn.Session, reason conn.Reason, v ...any) {
+		n++
+	})
+	onClosed(a, conn.ENoError)
+	//关闭后退出所有分组，空分组删除
+	if n != 1 || r.Len() != 1 || len(r.Group("room")) != 1 || r.Group("room")[0] != b || len(r.Group("hall")) != 0 {
+		t.Fatalf("n %v len %v room %v hall %v", n, r.Len(), len(r.Group("room")), len(r.Group("hall")))
+	}
+	onClosed(b, conn.ENoError)
+	if r.Len() != 0 || r.Users() != 0 || len(r.Group("room")) != 0 {
+		t.Fatalf("len %v users %v room %v", r.Len(), r.Users(), len(r.Group("room")))
+	}
+	//已移除会话不可加入分组
+	if err := r.Join(a, "room"); err != user_session.ErrNotLogin {
+		t.Fatalf("want ErrNotLogin, got %v", err)
+	}
+}